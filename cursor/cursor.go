@@ -0,0 +1,106 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+// The most items a client can ask for in one page
+const MAX_LIMIT = 100
+
+var ErrInvalid = errors.New("invalid cursor")
+
+// List is a sorted list that can be paged through. A cursor holds the sort
+// keys of the item a page starts after (or ends before), so it keeps working
+// even if that item has since been deleted.
+type List interface {
+	Len() int
+	// Key is what a cursor needs to find item i's place again
+	Key(i int) interface{}
+	// Locate decodes a key made by Key, and returns whether item i sorts
+	// before it and whether it sorts after it. It is ErrInvalid when the key
+	// isn't one Key could have made.
+	Locate(key []byte) (before, after func(i int) bool, err error)
+}
+
+// Links are opaque cursors for the neighbouring pages, empty when there isn't one
+type Links struct {
+	Next string
+	Prev string
+}
+
+// Page is where one page starts and ends in a List
+type Page struct {
+	Start int
+	End   int
+	Links
+}
+
+type cursor struct {
+	Before bool            `json:"b,omitempty"`
+	Key    json.RawMessage `json:"k"`
+}
+
+func encode(list List, i int, before bool) string {
+	key, _ := json.Marshal(list.Key(i))
+	data, _ := json.Marshal(cursor{Before: before, Key: key})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || len(c.Key) == 0 {
+		return nil, ErrInvalid
+	}
+	return &c, nil
+}
+
+// Paginate finds the page of at most limit items in list at cursor after.
+// An empty cursor is the first page and a limit of zero means no limit.
+func Paginate(list List, limit int, after string) (*Page, error) {
+	n := list.Len()
+	if limit <= 0 {
+		limit = n
+	}
+
+	start, end := 0, n
+	if after != "" {
+		c, err := decode(after)
+		if err != nil {
+			return nil, err
+		}
+		before, later, err := list.Locate(c.Key)
+		if err != nil {
+			return nil, ErrInvalid
+		}
+		if c.Before {
+			// First item that doesn't sort before the pivot
+			end = sort.Search(n, func(i int) bool { return !before(i) })
+			start = end - limit
+			if start < 0 {
+				start = 0
+			}
+		} else {
+			// First item that sorts after the pivot
+			start = sort.Search(n, later)
+		}
+	}
+	if start+limit < end {
+		end = start + limit
+	}
+
+	page := &Page{Start: start, End: end}
+	if end < n && end > start {
+		page.Next = encode(list, end-1, false)
+	}
+	if start > 0 && end > start {
+		page.Prev = encode(list, start, true)
+	}
+	return page, nil
+}
@@ -0,0 +1,58 @@
+package cursor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// Even numbers, which leaves gaps for the ones that have been deleted
+type evens []int
+
+func (l evens) Len() int { return len(l) }
+
+func (l evens) Key(i int) interface{} { return l[i] }
+
+func (l evens) Locate(data []byte) (func(i int) bool, func(i int) bool, error) {
+	var pivot int
+	if err := json.Unmarshal(data, &pivot); err != nil {
+		return nil, nil, ErrInvalid
+	}
+	return func(i int) bool { return l[i] < pivot }, func(i int) bool { return l[i] > pivot }, nil
+}
+
+func TestPaginateWithoutLimit(t *testing.T) {
+	page, err := Paginate(evens{0, 2, 4}, 0, "")
+	assert.NilError(t, err, "should have no errors")
+	assert.Assert(t, is.DeepEqual(*page, Page{Start: 0, End: 3}), "should return everything on one page")
+}
+
+func TestPaginateForwardsAndBack(t *testing.T) {
+	list := evens{0, 2, 4, 6, 8}
+	first, _ := Paginate(list, 2, "")
+	assert.Assert(t, is.Equal(first.Prev, ""), "should have no previous page")
+	second, _ := Paginate(list, 2, first.Next)
+	assert.Assert(t, is.Equal(second.Start, 2), "should start after the first page")
+	third, _ := Paginate(list, 2, second.Next)
+	assert.Assert(t, is.Equal(third.End-third.Start, 1), "should have what is left")
+	assert.Assert(t, is.Equal(third.Next, ""), "should have no next page")
+
+	back, _ := Paginate(list, 2, third.Prev)
+	assert.Assert(t, is.DeepEqual([]int{back.Start, back.End}, []int{second.Start, second.End}), "should go back a page")
+}
+
+func TestPaginateAfterDeletedItem(t *testing.T) {
+	first, _ := Paginate(evens{0, 2, 4, 6}, 2, "")
+	second, err := Paginate(evens{0, 4, 6}, 2, first.Next)
+	assert.NilError(t, err, "should have no errors")
+	assert.Assert(t, is.Equal(second.Start, 1), "should carry on from where the deleted item was")
+}
+
+func TestPaginateInvalidCursor(t *testing.T) {
+	_, err := Paginate(evens{0, 2}, 1, "not a cursor")
+	assert.Equal(t, err, ErrInvalid)
+	_, err = Paginate(evens{0, 2}, 1, "e30")
+	assert.Equal(t, err, ErrInvalid, "should refuse a cursor without a key")
+}
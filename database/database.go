@@ -0,0 +1,260 @@
+package database
+
+import (
+	"database/sql"
+	"farmstall/problems"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const SCHEME = "sqlite://"
+
+// Each entry is one schema version, applied in order and exactly once.
+// Never edit an entry that has shipped, append a new one instead.
+var migrations = []string{
+	// 1: initial schema
+	`CREATE TABLE reviews (
+		uuid    TEXT PRIMARY KEY,
+		message TEXT NOT NULL,
+		rating  INTEGER NOT NULL,
+		user_id TEXT
+	);
+	CREATE TABLE users (
+		uuid      TEXT PRIMARY KEY,
+		username  TEXT NOT NULL UNIQUE,
+		full_name TEXT NOT NULL
+	);
+	CREATE TABLE passwords (
+		user_id TEXT PRIMARY KEY,
+		hash    TEXT NOT NULL
+	);
+	CREATE TABLE tokens (
+		user_id TEXT PRIMARY KEY,
+		token   TEXT NOT NULL
+	);`,
+	// 2: filtering reviews by author
+	`CREATE INDEX reviews_user_id ON reviews (user_id);`,
+	// 3: review timestamps, in unix nanoseconds
+	`ALTER TABLE reviews ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE reviews ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+	CREATE INDEX reviews_created_at ON reviews (created_at);`,
+	// 4: review versions, for optimistic concurrency
+	`ALTER TABLE reviews ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+	// 5: who changed a review, and every version it has been through
+	`ALTER TABLE reviews ADD COLUMN updated_by TEXT;
+	UPDATE reviews SET updated_by = user_id;
+	CREATE TABLE review_revisions (
+		review_id  TEXT NOT NULL,
+		revision   INTEGER NOT NULL,
+		message    TEXT NOT NULL,
+		rating     INTEGER NOT NULL,
+		changed_by TEXT,
+		changed_at INTEGER NOT NULL,
+		PRIMARY KEY (review_id, revision)
+	);
+	INSERT INTO review_revisions SELECT uuid, version, message, rating, updated_by, updated_at FROM reviews;`,
+	// 6: soft deletes, in unix nanoseconds
+	`ALTER TABLE reviews ADD COLUMN deleted_at INTEGER;
+	CREATE INDEX reviews_deleted_at ON reviews (deleted_at);`,
+	// 7: stalls, and which stall a review is about
+	`CREATE TABLE stalls (
+		uuid        TEXT PRIMARY KEY,
+		name        TEXT NOT NULL,
+		description TEXT NOT NULL,
+		location    TEXT NOT NULL,
+		owner_id    TEXT NOT NULL,
+		created_at  INTEGER NOT NULL,
+		updated_at  INTEGER NOT NULL
+	);
+	ALTER TABLE reviews ADD COLUMN stall_id TEXT;
+	CREATE INDEX reviews_stall_id ON reviews (stall_id);`,
+	// 8: running totals of live reviews per author, stall and rating. Triggers
+	// keep them in step with reviews, anonymous and general reviews use ''
+	`CREATE TABLE review_stats (
+		user_id  TEXT NOT NULL,
+		stall_id TEXT NOT NULL,
+		rating   INTEGER NOT NULL,
+		count    INTEGER NOT NULL,
+		PRIMARY KEY (user_id, stall_id, rating)
+	);
+	INSERT INTO review_stats
+		SELECT COALESCE(user_id, ''), COALESCE(stall_id, ''), rating, COUNT(*) FROM reviews
+		WHERE deleted_at IS NULL GROUP BY 1, 2, 3;
+	CREATE TRIGGER review_stats_insert AFTER INSERT ON reviews WHEN NEW.deleted_at IS NULL
+	BEGIN
+		INSERT INTO review_stats VALUES (COALESCE(NEW.user_id, ''), COALESCE(NEW.stall_id, ''), NEW.rating, 1)
+			ON CONFLICT (user_id, stall_id, rating) DO UPDATE SET count = count + 1;
+	END;
+	CREATE TRIGGER review_stats_update AFTER UPDATE OF rating, user_id, stall_id, deleted_at ON reviews
+	BEGIN
+		UPDATE review_stats SET count = count - 1
+			WHERE OLD.deleted_at IS NULL AND user_id = COALESCE(OLD.user_id, '') AND stall_id = COALESCE(OLD.stall_id, '') AND rating = OLD.rating;
+		INSERT INTO review_stats SELECT COALESCE(NEW.user_id, ''), COALESCE(NEW.stall_id, ''), NEW.rating, 1
+			WHERE NEW.deleted_at IS NULL
+			ON CONFLICT (user_id, stall_id, rating) DO UPDATE SET count = count + 1;
+	END;
+	CREATE TRIGGER review_stats_delete AFTER DELETE ON reviews WHEN OLD.deleted_at IS NULL
+	BEGIN
+		UPDATE review_stats SET count = count - 1
+			WHERE user_id = COALESCE(OLD.user_id, '') AND stall_id = COALESCE(OLD.stall_id, '') AND rating = OLD.rating;
+	END;`,
+	// 9: replies to reviews, which go when their review is purged
+	`CREATE TABLE review_replies (
+		uuid       TEXT PRIMARY KEY,
+		review_id  TEXT NOT NULL REFERENCES reviews (uuid) ON DELETE CASCADE,
+		message    TEXT NOT NULL,
+		user_id    TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE INDEX review_replies_review_id ON review_replies (review_id, created_at);`,
+	// 10: helpful votes. The counts on reviews are worked out from review_votes
+	// whenever a vote changes
+	`ALTER TABLE reviews ADD COLUMN helpful INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE reviews ADD COLUMN unhelpful INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE review_votes (
+		review_id TEXT NOT NULL REFERENCES reviews (uuid) ON DELETE CASCADE,
+		voter     TEXT NOT NULL,
+		helpful   INTEGER NOT NULL,
+		PRIMARY KEY (review_id, voter)
+	);`,
+	// 11: moderation. Only published reviews are counted in review_stats.
+	`ALTER TABLE reviews ADD COLUMN status TEXT NOT NULL DEFAULT 'published';
+	CREATE TABLE review_flags (
+		uuid       TEXT PRIMARY KEY,
+		review_id  TEXT NOT NULL REFERENCES reviews (uuid) ON DELETE CASCADE,
+		reason     TEXT NOT NULL,
+		reporter   TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		UNIQUE (review_id, reporter)
+	);
+	DROP TRIGGER review_stats_insert;
+	DROP TRIGGER review_stats_update;
+	DROP TRIGGER review_stats_delete;
+	CREATE TRIGGER review_stats_insert AFTER INSERT ON reviews WHEN NEW.deleted_at IS NULL AND NEW.status = 'published'
+	BEGIN
+		INSERT INTO review_stats VALUES (COALESCE(NEW.user_id, ''), COALESCE(NEW.stall_id, ''), NEW.rating, 1)
+			ON CONFLICT (user_id, stall_id, rating) DO UPDATE SET count = count + 1;
+	END;
+	CREATE TRIGGER review_stats_update AFTER UPDATE OF rating, user_id, stall_id, deleted_at, status ON reviews
+	BEGIN
+		UPDATE review_stats SET count = count - 1
+			WHERE OLD.deleted_at IS NULL AND OLD.status = 'published'
+			AND user_id = COALESCE(OLD.user_id, '') AND stall_id = COALESCE(OLD.stall_id, '') AND rating = OLD.rating;
+		INSERT INTO review_stats SELECT COALESCE(NEW.user_id, ''), COALESCE(NEW.stall_id, ''), NEW.rating, 1
+			WHERE NEW.deleted_at IS NULL AND NEW.status = 'published'
+			ON CONFLICT (user_id, stall_id, rating) DO UPDATE SET count = count + 1;
+	END;
+	CREATE TRIGGER review_stats_delete AFTER DELETE ON reviews WHEN OLD.deleted_at IS NULL AND OLD.status = 'published'
+	BEGIN
+		UPDATE review_stats SET count = count - 1
+			WHERE user_id = COALESCE(OLD.user_id, '') AND stall_id = COALESCE(OLD.stall_id, '') AND rating = OLD.rating;
+	END;`,
+	// 12: only a hash of each token is kept, along with when it expires. The
+	// old plain text tokens came from math/rand, so they are revoked rather
+	// than hashed
+	`DROP TABLE tokens;
+	CREATE TABLE tokens (
+		user_id    TEXT PRIMARY KEY,
+		hash       TEXT NOT NULL UNIQUE,
+		expires_at INTEGER
+	);`,
+	// 13: many sessions per user, looked up by the hash of their token. The
+	// tokens from 12 carry on as sessions of their own, with new uuids.
+	`ALTER TABLE tokens RENAME TO old_tokens;
+	CREATE TABLE tokens (
+		uuid         TEXT PRIMARY KEY,
+		hash         TEXT NOT NULL UNIQUE,
+		user_id      TEXT NOT NULL,
+		label        TEXT NOT NULL DEFAULT '',
+		user_agent   TEXT NOT NULL DEFAULT '',
+		created_at   INTEGER NOT NULL,
+		last_used_at INTEGER NOT NULL,
+		expires_at   INTEGER
+	);
+	CREATE INDEX tokens_user_id ON tokens (user_id, created_at);
+	INSERT INTO tokens (uuid, hash, user_id, created_at, last_used_at, expires_at)
+		SELECT lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+			substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))),
+			hash, user_id, strftime('%s', 'now') * 1000000000, strftime('%s', 'now') * 1000000000, expires_at
+		FROM old_tokens;
+	DROP TABLE old_tokens;`,
+	// 14: refresh tokens, which only get new signed access tokens
+	`ALTER TABLE tokens ADD COLUMN refresh INTEGER NOT NULL DEFAULT 0;`,
+}
+
+// Open connects to the database described by url, eg: sqlite:///var/lib/farmstall.db
+// The schema is created on first run and migrated to the latest version after that.
+func Open(url string) (*sql.DB, error) {
+	if !strings.HasPrefix(url, SCHEME) {
+		return nil, fmt.Errorf("unsupported database url %q, expected %s<path>", url, SCHEME)
+	}
+	path := strings.TrimPrefix(url, SCHEME)
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_foreign_keys=on")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows a single writer, so don't bother pooling
+	db.SetMaxOpenConns(1)
+
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Version returns the schema version the database is currently at
+func Version(db *sql.DB) (int, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// Migrate applies every migration newer than the current schema version
+func Migrate(db *sql.DB) error {
+	current, err := Version(db)
+	if err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %s", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Error turns a database error into the problem the stores return for it
+func Error(err error) error {
+	return problems.Internal(problems.ProblemJson{
+		Detail: err.Error(),
+	})
+}
+
+// Scanner is a *sql.Row or *sql.Rows, so the stores can read a row the same
+// way whether they fetched one or many
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestOpenCreatesSchema(t *testing.T) {
+	db, err := Open(SCHEME + filepath.Join(t.TempDir(), "farmstall.db"))
+	assert.NilError(t, err, "should have no errors")
+	defer db.Close()
+
+	version, err := Version(db)
+	assert.NilError(t, err, "should have no errors")
+	assert.Assert(t, is.Equal(version, len(migrations)), "should be migrated to the latest version")
+}
+
+func TestReopenKeepsData(t *testing.T) {
+	url := SCHEME + filepath.Join(t.TempDir(), "farmstall.db")
+	db, err := Open(url)
+	assert.NilError(t, err, "should have no errors")
+	_, err = db.Exec(`INSERT INTO reviews (uuid, message, rating) VALUES ('abc', 'good', 5)`)
+	assert.NilError(t, err, "should have no errors")
+	db.Close()
+
+	db, err = Open(url)
+	assert.NilError(t, err, "should not re-apply migrations")
+	defer db.Close()
+
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM reviews`).Scan(&count)
+	assert.Assert(t, is.Equal(count, 1), "should survive a restart")
+}
+
+func TestOpenUnsupportedScheme(t *testing.T) {
+	_, err := Open("postgres://localhost/farmstall")
+	assert.ErrorContains(t, err, "unsupported database url")
+}
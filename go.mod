@@ -5,15 +5,18 @@ go 1.12
 require github.com/gorilla/mux v1.7.0
 
 require (
+	github.com/evanphx/json-patch v4.12.0+incompatible
 	github.com/getkin/kin-openapi v0.2.0
 	github.com/ghodss/yaml v1.0.0
 	github.com/go-yaml/yaml v2.1.0+incompatible
-	github.com/google/go-cmp v0.2.0 // indirect
 	github.com/google/uuid v1.1.1
+	github.com/mattn/go-sqlite3 v1.14.16
+	github.com/microcosm-cc/bluemonday v1.0.27
 	github.com/pkg/errors v0.8.1 // indirect
 	github.com/rs/cors v1.6.0
 	github.com/ulule/limiter v2.2.2+incompatible
 	github.com/ulule/limiter/v3 v3.1.0
-	golang.org/x/crypto v0.0.0-20180820150726-614d502a4dac
+	github.com/yuin/goldmark v1.5.4
+	golang.org/x/crypto v0.24.0
 	gotest.tools v2.2.0+incompatible
 )
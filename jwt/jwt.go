@@ -0,0 +1,195 @@
+// Package jwt signs and verifies the compact JSON Web Tokens handed out as
+// access tokens. Only the one algorithm a set of keys is configured for is
+// accepted, so a token can't pick a weaker one for itself.
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Supported algorithms
+const (
+	HS256 = "HS256"
+	EDDSA = "EdDSA"
+)
+
+var (
+	ErrInvalid    = errors.New("invalid token")
+	ErrUnknownKey = errors.New("token signed with an unknown key")
+	ErrExpired    = errors.New("token expired")
+)
+
+// Claims are what an access token says about its holder
+type Claims struct {
+	// The user's uuid
+	Subject string `json:"sub"`
+	// The session the token was issued for
+	Session   string `json:"sid,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+type key struct {
+	id      string
+	secret  []byte
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// Keys signs with the first of its keys and verifies with any of them, so a
+// new key can be rotated in while tokens signed by the old one run out.
+type Keys struct {
+	alg  string
+	keys []key
+}
+
+// ParseKeys reads comma separated kid:key pairs, newest first. Keys are base64,
+// a secret of at least 32 bytes for HS256 or a 32 byte Ed25519 seed for EdDSA.
+func ParseKeys(alg string, spec string) (*Keys, error) {
+	if alg != HS256 && alg != EDDSA {
+		return nil, fmt.Errorf("unsupported algorithm %q, expected %s or %s", alg, HS256, EDDSA)
+	}
+	ks := &Keys{alg: alg}
+	seen := map[string]bool{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("expected kid:key, got %q", pair)
+		}
+		id := parts[0]
+		if seen[id] {
+			return nil, fmt.Errorf("key %s is listed twice", id)
+		}
+		seen[id] = true
+		material, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("key %s isn't base64: %s", id, err)
+		}
+		k := key{id: id}
+		switch alg {
+		case HS256:
+			if len(material) < 32 {
+				return nil, fmt.Errorf("key %s is %d bytes, HS256 needs at least 32", id, len(material))
+			}
+			k.secret = material
+		case EDDSA:
+			if len(material) != ed25519.SeedSize {
+				return nil, fmt.Errorf("key %s is %d bytes, an Ed25519 seed is %d", id, len(material), ed25519.SeedSize)
+			}
+			k.private = ed25519.NewKeyFromSeed(material)
+			k.public = k.private.Public().(ed25519.PublicKey)
+		}
+		ks.keys = append(ks.keys, k)
+	}
+	if len(ks.keys) == 0 {
+		return nil, errors.New("no keys given")
+	}
+	return ks, nil
+}
+
+func encode(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func (ks *Keys) sign(k key, input string) []byte {
+	if ks.alg == EDDSA {
+		return ed25519.Sign(k.private, []byte(input))
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte(input))
+	return mac.Sum(nil)
+}
+
+// Sign issues a token for claims with the newest key
+func (ks *Keys) Sign(claims Claims) (string, error) {
+	k := ks.keys[0]
+	h, err := encode(header{Alg: ks.alg, Typ: "JWT", Kid: k.id})
+	if err != nil {
+		return "", err
+	}
+	c, err := encode(claims)
+	if err != nil {
+		return "", err
+	}
+	input := h + "." + c
+	return input + "." + base64.RawURLEncoding.EncodeToString(ks.sign(k, input)), nil
+}
+
+// Verify checks a token's signature and expiry, and returns its claims
+func (ks *Keys) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalid
+	}
+	var h header
+	if err := decode(parts[0], &h); err != nil || h.Alg != ks.alg {
+		return nil, ErrInvalid
+	}
+	var k *key
+	for i := range ks.keys {
+		if ks.keys[i].id == h.Kid {
+			k = &ks.keys[i]
+			break
+		}
+	}
+	if k == nil {
+		return nil, ErrUnknownKey
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	input := parts[0] + "." + parts[1]
+	if ks.alg == EDDSA {
+		if !ed25519.Verify(k.public, []byte(input), sig) {
+			return nil, ErrInvalid
+		}
+	} else if !hmac.Equal(sig, ks.sign(*k, input)) {
+		return nil, ErrInvalid
+	}
+
+	var claims Claims
+	if err := decode(parts[1], &claims); err != nil || claims.Subject == "" {
+		return nil, ErrInvalid
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return &claims, ErrExpired
+	}
+	return &claims, nil
+}
+
+func decode(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Looks reports whether a token is shaped like a JWT, rather than an opaque token
+func Looks(token string) bool {
+	return strings.Count(token, ".") == 2
+}
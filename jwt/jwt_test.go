@@ -0,0 +1,105 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+var secret = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+var seed = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+
+// backends lists every algorithm the tests run against
+var backends = map[string]string{
+	HS256: "one:" + secret,
+	EDDSA: "one:" + seed,
+}
+
+func forEachAlg(t *testing.T, test func(t *testing.T, alg string, keys string)) {
+	for alg, keys := range backends {
+		alg, keys := alg, keys
+		t.Run(alg, func(t *testing.T) {
+			test(t, alg, keys)
+		})
+	}
+}
+
+func claims(now time.Time) Claims {
+	return Claims{Subject: "user", Session: "session", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	forEachAlg(t, func(t *testing.T, alg string, spec string) {
+		keys, err := ParseKeys(alg, spec)
+		assert.NilError(t, err, "should parse the keys")
+		now := time.Now()
+
+		token, err := keys.Sign(claims(now))
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, Looks(token))
+
+		got, err := keys.Verify(token, now)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.DeepEqual(*got, claims(now)))
+
+		_, err = keys.Verify(token, now.Add(time.Minute))
+		assert.Equal(t, err, ErrExpired)
+	})
+}
+
+func TestTamperedToken(t *testing.T) {
+	forEachAlg(t, func(t *testing.T, alg string, spec string) {
+		keys, _ := ParseKeys(alg, spec)
+		now := time.Now()
+		token, _ := keys.Sign(claims(now))
+		parts := strings.Split(token, ".")
+
+		other := claims(now)
+		other.Subject = "admin"
+		forged, _ := encode(other)
+		_, err := keys.Verify(parts[0]+"."+forged+"."+parts[2], now)
+		assert.Equal(t, err, ErrInvalid, "should not accept changed claims")
+
+		none, _ := encode(header{Alg: "none", Kid: "one"})
+		_, err = keys.Verify(none+"."+parts[1]+".", now)
+		assert.Equal(t, err, ErrInvalid, "should only accept its own algorithm")
+
+		_, err = keys.Verify("not a token", now)
+		assert.Equal(t, err, ErrInvalid)
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	forEachAlg(t, func(t *testing.T, alg string, spec string) {
+		old, _ := ParseKeys(alg, spec)
+		now := time.Now()
+		token, _ := old.Sign(claims(now))
+
+		material := strings.SplitN(spec, ":", 2)[1]
+		rotated, err := ParseKeys(alg, "two:"+material+",one:"+material)
+		assert.NilError(t, err, "should parse the keys")
+		_, err = rotated.Verify(token, now)
+		assert.NilError(t, err, "should still accept tokens signed by the old key")
+
+		fresh, _ := rotated.Sign(claims(now))
+		_, err = old.Verify(fresh, now)
+		assert.Equal(t, err, ErrUnknownKey, "should sign with the newest key")
+	})
+}
+
+func TestParseKeys(t *testing.T) {
+	_, err := ParseKeys("RS256", "one:"+secret)
+	assert.ErrorContains(t, err, "unsupported algorithm")
+	_, err = ParseKeys(HS256, "")
+	assert.ErrorContains(t, err, "no keys")
+	_, err = ParseKeys(HS256, "one:"+base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.ErrorContains(t, err, "at least 32")
+	_, err = ParseKeys(EDDSA, "one:"+secret+",one:"+seed)
+	assert.ErrorContains(t, err, "listed twice")
+	_, err = ParseKeys(HS256, secret)
+	assert.ErrorContains(t, err, "expected kid:key")
+}
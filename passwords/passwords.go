@@ -2,6 +2,7 @@ package passwords
 
 import (
 	"golang.org/x/crypto/bcrypt"
+	"sync"
 )
 
 type PasswordError struct {
@@ -12,9 +13,22 @@ func (p *PasswordError) Error() string {
 	return p.Msg
 }
 
+// Store is implemented by every backend that can hold password hashes
+type Store interface {
+	Add(uuid string, pwd string) error
+	Get(uuid string) (string, error)
+	Verify(uuid string, plainPwd string) (bool, error)
+	// Delete removes the password of one user, if they have one
+	Delete(uuid string) error
+	// Clear removes every password
+	Clear() error
+}
+
 // From https://medium.com/@jcox250/password-hash-salt-using-golang-b041dc94cb72
 
+// PasswordStore is the in-memory Store. It is safe for concurrent use.
 type PasswordStore struct {
+	mu        sync.RWMutex
 	passwords map[string]string
 }
 
@@ -26,24 +40,21 @@ func NewPasswordStore() *PasswordStore {
 }
 
 func (p *PasswordStore) Add(uuid string, pwd string) error {
-
-	// Use GenerateFromPassword to hash & salt pwd.
-	// MinCost is just an integer constant provided by the bcrypt
-	// package along with DefaultCost & MaxCost.
-	// The cost can be any value you want provided it isn't lower
-	// than the MinCost (4)
-	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.MinCost)
+	hash, err := hash(pwd)
 	if err != nil {
 		return err
 	}
-	// GenerateFromPassword returns a byte slice so we need to
-	// convert the bytes to a string and return it
 
-	p.passwords[uuid] = string(hash)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.passwords[uuid] = hash
 	return nil
 }
 
 func (p *PasswordStore) Get(uuid string) (string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	hash, found := p.passwords[uuid]
 	if !found {
 		return "", &PasswordError{Msg: "Password not in system"}
@@ -52,6 +63,41 @@ func (p *PasswordStore) Get(uuid string) (string, error) {
 }
 
 func (p *PasswordStore) Verify(uuid string, plainPwd string) (bool, error) {
+	return verify(p, uuid, plainPwd)
+}
+
+func (p *PasswordStore) Delete(uuid string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.passwords, uuid)
+	return nil
+}
+
+func (p *PasswordStore) Clear() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.passwords = make(map[string]string)
+	return nil
+}
+
+func hash(pwd string) (string, error) {
+	// Use GenerateFromPassword to hash & salt pwd.
+	// MinCost is just an integer constant provided by the bcrypt
+	// package along with DefaultCost & MaxCost.
+	// The cost can be any value you want provided it isn't lower
+	// than the MinCost (4)
+	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.MinCost)
+	if err != nil {
+		return "", err
+	}
+	// GenerateFromPassword returns a byte slice so we need to
+	// convert the bytes to a string and return it
+	return string(hash), nil
+}
+
+func verify(p Store, uuid string, plainPwd string) (bool, error) {
 	hashedPwd, getErr := p.Get(uuid)
 
 	if getErr != nil {
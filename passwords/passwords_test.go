@@ -1,35 +1,96 @@
 package passwords
 
 import (
+	"fmt"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	// "github.com/google/uuid"
+	"farmstall/database"
 	"gotest.tools/assert"
 	is "gotest.tools/assert/cmp"
 )
 
+// backends lists every Store implementation the tests run against
+var backends = map[string]func(t *testing.T) Store{
+	"memory": func(t *testing.T) Store {
+		return NewPasswordStore()
+	},
+	"sqlite": func(t *testing.T) Store {
+		db, err := database.Open(database.SCHEME + filepath.Join(t.TempDir(), "farmstall.db"))
+		assert.NilError(t, err, "should open the database")
+		t.Cleanup(func() { db.Close() })
+		return NewSQLPasswordStore(db)
+	},
+}
+
+func forEachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	for name, newStore := range backends {
+		newStore := newStore
+		t.Run(name, func(t *testing.T) {
+			test(t, newStore(t))
+		})
+	}
+}
+
 func TestAddAndCompareGoodPassword(t *testing.T) {
-	uuid := "abc"
-	store := NewPasswordStore()
-	store.Add(uuid, "password")
-	res, err := store.Verify(uuid, "password")
-	assert.NilError(t, err, "should have no errors")
-	assert.Assert(t, res, 0, "should return true, as passwords match")
+	forEachStore(t, func(t *testing.T, store Store) {
+		uuid := "abc"
+		store.Add(uuid, "password")
+		res, err := store.Verify(uuid, "password")
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, res, 0, "should return true, as passwords match")
+	})
 }
 
 func TestAddAndCompareBadPassword(t *testing.T) {
-	uuid := "abc"
-	store := NewPasswordStore()
-	store.Add(uuid, "password")
-	res, err := store.Verify(uuid, "bad")
-	assert.Error(t, err, "Hash comparison failed")
-	assert.Assert(t, !res, 0, "should return false, as passwords DO NOT match")
+	forEachStore(t, func(t *testing.T, store Store) {
+		uuid := "abc"
+		store.Add(uuid, "password")
+		res, err := store.Verify(uuid, "bad")
+		assert.Error(t, err, "Hash comparison failed")
+		assert.Assert(t, !res, 0, "should return false, as passwords DO NOT match")
+	})
 }
 
 func TestAddAndCompareMissingPassword(t *testing.T) {
-	uuid := "abc"
-	store := NewPasswordStore()
-	res, err := store.Verify(uuid, "password")
-	assert.Error(t, err, "Password not in system")
-	assert.Assert(t, is.Equal(res, false), 0, "should return false, as passwords DO NOT match")
+	forEachStore(t, func(t *testing.T, store Store) {
+		uuid := "abc"
+		res, err := store.Verify(uuid, "password")
+		assert.Error(t, err, "Password not in system")
+		assert.Assert(t, is.Equal(res, false), 0, "should return false, as passwords DO NOT match")
+	})
+}
+
+func TestDeletePassword(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		store.Add("abc", "password")
+		store.Add("def", "password")
+		assert.NilError(t, store.Delete("abc"))
+		_, err := store.Verify("abc", "password")
+		assert.Error(t, err, "Password not in system")
+		res, err := store.Verify("def", "password")
+		assert.NilError(t, err, "other passwords should stay")
+		assert.Assert(t, res)
+	})
+}
+
+// Run with -race to catch unsynchronised access
+func TestConcurrentAddAndVerify(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				uuid := fmt.Sprintf("user%d", i)
+				assert.Check(t, store.Add(uuid, "password"), "should add")
+				res, err := store.Verify(uuid, "password")
+				assert.Check(t, err, "should verify")
+				assert.Check(t, res, "should match")
+			}(i)
+		}
+		wg.Wait()
+	})
 }
@@ -0,0 +1,51 @@
+package passwords
+
+import (
+	"database/sql"
+)
+
+// SQLPasswordStore is a Store backed by a database opened with farmstall/database
+type SQLPasswordStore struct {
+	db *sql.DB
+}
+
+func NewSQLPasswordStore(db *sql.DB) *SQLPasswordStore {
+	return &SQLPasswordStore{db: db}
+}
+
+var _ Store = (*SQLPasswordStore)(nil)
+
+func (p *SQLPasswordStore) Add(uuid string, pwd string) error {
+	hash, err := hash(pwd)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.Exec(`INSERT OR REPLACE INTO passwords (user_id, hash) VALUES (?, ?)`, uuid, hash)
+	return err
+}
+
+func (p *SQLPasswordStore) Get(uuid string) (string, error) {
+	var hash string
+	err := p.db.QueryRow(`SELECT hash FROM passwords WHERE user_id = ?`, uuid).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", &PasswordError{Msg: "Password not in system"}
+	}
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func (p *SQLPasswordStore) Verify(uuid string, plainPwd string) (bool, error) {
+	return verify(p, uuid, plainPwd)
+}
+
+func (p *SQLPasswordStore) Delete(uuid string) error {
+	_, err := p.db.Exec(`DELETE FROM passwords WHERE user_id = ?`, uuid)
+	return err
+}
+
+func (p *SQLPasswordStore) Clear() error {
+	_, err := p.db.Exec(`DELETE FROM passwords`)
+	return err
+}
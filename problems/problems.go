@@ -37,6 +37,36 @@ func InvalidCreds(pj ProblemJson) *ProblemJson {
 	}
 }
 
+func TokenExpired(pj ProblemJson) *ProblemJson {
+	return &ProblemJson{
+		Type:     "/token-expired",
+		Title:    "The token has expired, create a new one",
+		Status:   403,
+		Detail:   pj.Detail,
+		Instance: pj.Instance,
+	}
+}
+
+func Forbidden(pj ProblemJson) *ProblemJson {
+	return &ProblemJson{
+		Type:     "/forbidden",
+		Title:    "Not allowed to perform this action",
+		Status:   403,
+		Detail:   pj.Detail,
+		Instance: pj.Instance,
+	}
+}
+
+func NotOwner(pj ProblemJson) *ProblemJson {
+	return &ProblemJson{
+		Type:     "/not-owner",
+		Title:    "Only the author, or an admin, may change this resource",
+		Status:   403,
+		Detail:   pj.Detail,
+		Instance: pj.Instance,
+	}
+}
+
 func InvalidRequest(pj ProblemJson) *ProblemJson {
 	return &ProblemJson{
 		Type:     "/invalid-request",
@@ -67,6 +97,66 @@ func FailedToParseJson(pj ProblemJson) *ProblemJson {
 	}
 }
 
+func UnsupportedMediaType(pj ProblemJson) *ProblemJson {
+	return &ProblemJson{
+		Type:     "/unsupported-media-type",
+		Title:    "The request body is in a format this operation doesn't accept",
+		Status:   415,
+		Detail:   pj.Detail,
+		Instance: pj.Instance,
+	}
+}
+
+func PatchFailed(pj ProblemJson) *ProblemJson {
+	return &ProblemJson{
+		Type:     "/patch-failed",
+		Title:    "Failed to apply the patch",
+		Status:   422,
+		Detail:   pj.Detail,
+		Instance: pj.Instance,
+	}
+}
+
+func Gone(pj ProblemJson) *ProblemJson {
+	return &ProblemJson{
+		Type:     "/gone",
+		Title:    "Resource has been deleted",
+		Status:   410,
+		Detail:   pj.Detail,
+		Instance: pj.Instance,
+	}
+}
+
+func PreconditionFailed(pj ProblemJson) *ProblemJson {
+	return &ProblemJson{
+		Type:     "/precondition-failed",
+		Title:    "The resource has changed since it was last fetched",
+		Status:   412,
+		Detail:   pj.Detail,
+		Instance: pj.Instance,
+	}
+}
+
+func InvalidReference(pj ProblemJson) *ProblemJson {
+	return &ProblemJson{
+		Type:     "/invalid-reference",
+		Title:    "Refers to a resource that doesn't exist",
+		Status:   422,
+		Detail:   pj.Detail,
+		Instance: pj.Instance,
+	}
+}
+
+func InUse(pj ProblemJson) *ProblemJson {
+	return &ProblemJson{
+		Type:     "/in-use",
+		Title:    "Resource is still referred to by others",
+		Status:   409,
+		Detail:   pj.Detail,
+		Instance: pj.Instance,
+	}
+}
+
 func UpdateNonExisting(pj ProblemJson) *ProblemJson {
 	return &ProblemJson{
 		Type:     "/update-non-existing",
@@ -87,6 +177,26 @@ func CreateAlreadyExists(pj ProblemJson) *ProblemJson {
 	}
 }
 
+func TooManySandboxes(pj ProblemJson) *ProblemJson {
+	return &ProblemJson{
+		Type:     "/too-many-sandboxes",
+		Title:    "No room for another sandbox",
+		Status:   503,
+		Detail:   pj.Detail,
+		Instance: pj.Instance,
+	}
+}
+
+func Internal(pj ProblemJson) *ProblemJson {
+	return &ProblemJson{
+		Type:     "/internal-error",
+		Title:    "Something went wrong on our side",
+		Status:   500,
+		Detail:   pj.Detail,
+		Instance: pj.Instance,
+	}
+}
+
 func Absolutify(pj *ProblemJson, probBase string, apiBase string) ProblemJson {
 	pj.Type = probBase + pj.Type
 
@@ -0,0 +1,103 @@
+package reset
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Status is what the API reports about resets, so attendees know when their data will vanish
+type Status struct {
+	LastResetAt *time.Time `json:"lastResetAt"`
+	NextResetAt *time.Time `json:"nextResetAt"`
+	// Go duration, eg: 24h0m0s. Empty when resets only happen on demand
+	Interval string `json:"interval"`
+}
+
+// Scheduler restores the starting dataset every Interval, or whenever Reset is called
+type Scheduler struct {
+	mu       sync.Mutex
+	interval time.Duration
+	reset    func() error
+	last     *time.Time
+	next     *time.Time
+	timer    *time.Timer
+	now      func() time.Time
+}
+
+// NewScheduler wraps reset, which should clear the stores and seed them again.
+// An interval of zero disables scheduled resets.
+func NewScheduler(interval time.Duration, reset func() error) *Scheduler {
+	return &Scheduler{
+		interval: interval,
+		reset:    reset,
+		now:      time.Now,
+	}
+}
+
+// Start schedules the first reset, if there is an interval
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedule()
+}
+
+// Stop cancels any pending scheduled reset
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.next = nil
+}
+
+// Reset restores the dataset immediately and pushes the next scheduled reset out by a full interval
+func (s *Scheduler) Reset() (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reset(); err != nil {
+		return s.status(), err
+	}
+	now := s.now()
+	s.last = &now
+	if s.timer != nil {
+		s.timer.Stop()
+		s.schedule()
+	}
+	return s.status(), nil
+}
+
+func (s *Scheduler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status()
+}
+
+// Callers must hold s.mu
+func (s *Scheduler) status() Status {
+	status := Status{
+		LastResetAt: s.last,
+		NextResetAt: s.next,
+	}
+	if s.interval > 0 {
+		status.Interval = s.interval.String()
+	}
+	return status
+}
+
+// Callers must hold s.mu
+func (s *Scheduler) schedule() {
+	if s.interval <= 0 {
+		return
+	}
+	next := s.now().Add(s.interval)
+	s.next = &next
+	s.timer = time.AfterFunc(s.interval, func() {
+		if _, err := s.Reset(); err != nil {
+			log.Printf("Scheduled reset failed. Error: %s", err)
+		}
+	})
+}
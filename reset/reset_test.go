@@ -0,0 +1,69 @@
+package reset
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestResetOnDemand(t *testing.T) {
+	var count int32
+	s := NewScheduler(0, func() error {
+		atomic.AddInt32(&count, 1)
+		return nil
+	})
+	s.Start()
+	defer s.Stop()
+
+	assert.Assert(t, s.Status().LastResetAt == nil, "should not have reset yet")
+
+	status, err := s.Reset()
+	assert.NilError(t, err, "should have no errors")
+	assert.Assert(t, is.Equal(atomic.LoadInt32(&count), int32(1)), "should have reset once")
+	assert.Assert(t, status.LastResetAt != nil, "should report the last reset")
+	assert.Assert(t, status.NextResetAt == nil, "should not schedule resets without an interval")
+	assert.Assert(t, is.Equal(status.Interval, ""), "should not report an interval")
+}
+
+func TestResetFailureKeepsLastReset(t *testing.T) {
+	s := NewScheduler(0, func() error {
+		return errors.New("nope")
+	})
+
+	status, err := s.Reset()
+	assert.Error(t, err, "nope")
+	assert.Assert(t, status.LastResetAt == nil, "should not count a failed reset")
+}
+
+func TestResetOnInterval(t *testing.T) {
+	var count int32
+	s := NewScheduler(10*time.Millisecond, func() error {
+		atomic.AddInt32(&count, 1)
+		return nil
+	})
+	s.Start()
+	defer s.Stop()
+
+	status := s.Status()
+	assert.Assert(t, status.NextResetAt != nil, "should report the next reset")
+	assert.Assert(t, is.Equal(status.Interval, "10ms"), "should report the interval")
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Assert(t, atomic.LoadInt32(&count) >= 2, "should keep resetting on the interval")
+	assert.Assert(t, s.Status().LastResetAt != nil, "should report the last reset")
+}
+
+func TestResetOnDemandPushesNextReset(t *testing.T) {
+	s := NewScheduler(time.Hour, func() error { return nil })
+	s.Start()
+	defer s.Stop()
+
+	before := *s.Status().NextResetAt
+	time.Sleep(5 * time.Millisecond)
+	status, _ := s.Reset()
+	assert.Assert(t, status.NextResetAt.After(before), "should be a full interval after the manual reset")
+}
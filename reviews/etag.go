@@ -0,0 +1,43 @@
+package reviews
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ETag is a strong entity tag for r, it changes whenever r's version does
+func ETag(r Review) string {
+	return `"` + strconv.Itoa(r.Version) + `"`
+}
+
+// IfMatch reports whether an If-Match header matches r. Weak tags never
+// match, as RFC 7232 asks for a strong comparison.
+func IfMatch(header string, r Review) bool {
+	return matchETag(header, r, false)
+}
+
+// IfNoneMatch reports whether an If-None-Match header matches r, in which
+// case a GET can answer 304. Tags are compared weakly.
+func IfNoneMatch(header string, r Review) bool {
+	return matchETag(header, r, true)
+}
+
+func matchETag(header string, r Review, weak bool) bool {
+	etag := ETag(r)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package reviews
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestETag(t *testing.T) {
+	review := Review{Version: 3}
+	assert.Equal(t, ETag(review), `"3"`)
+}
+
+func TestIfMatch(t *testing.T) {
+	review := Review{Version: 3}
+	assert.Assert(t, IfMatch(`"3"`, review), "should match its own tag")
+	assert.Assert(t, IfMatch(`"1", "3"`, review), "should match any tag in a list")
+	assert.Assert(t, IfMatch(`*`, review), "should match a wildcard")
+	assert.Assert(t, !IfMatch(`"2"`, review), "should not match another version")
+	assert.Assert(t, !IfMatch(`W/"3"`, review), "should not match a weak tag")
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	review := Review{Version: 3}
+	assert.Assert(t, IfNoneMatch(`"3"`, review), "should match its own tag")
+	assert.Assert(t, IfNoneMatch(`W/"3"`, review), "should match a weak tag")
+	assert.Assert(t, !IfNoneMatch(`"2", W/"4"`, review), "should not match other versions")
+}
@@ -0,0 +1,172 @@
+package reviews
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"farmstall/problems"
+)
+
+// ReviewFilters narrows down a list of reviews. Zero values don't filter anything.
+type ReviewFilters struct {
+	MaxRating     int        `json:"maxRating"`
+	MinRating     int        `json:"minRating"`
+	UserID        string     `json:"userId"`
+	StallID       string     `json:"stallId"`
+	Anonymous     *bool      `json:"anonymous"`
+	CreatedBefore *time.Time `json:"createdBefore"`
+	CreatedAfter  *time.Time `json:"createdAfter"`
+}
+
+func (f ReviewFilters) Match(r Review) bool {
+	if f.MaxRating != 0 && r.Rating > f.MaxRating {
+		return false
+	}
+	if f.MinRating != 0 && r.Rating < f.MinRating {
+		return false
+	}
+	if f.UserID != "" && r.UserID != f.UserID {
+		return false
+	}
+	if f.StallID != "" && r.StallID != f.StallID {
+		return false
+	}
+	if f.Anonymous != nil && (r.UserID == "") != *f.Anonymous {
+		return false
+	}
+	if f.CreatedBefore != nil && !r.CreatedAt.Before(*f.CreatedBefore) {
+		return false
+	}
+	if f.CreatedAfter != nil && !r.CreatedAt.After(*f.CreatedAfter) {
+		return false
+	}
+	return true
+}
+
+func invalidParam(name string, expected string) error {
+	return problems.InvalidRequest(problems.ProblemJson{
+		Detail: fmt.Sprintf("Query parameter, %s, must be %s", name, expected),
+	})
+}
+
+func parseRating(query url.Values, name string) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	rating, err := strconv.Atoi(value)
+	if err != nil || rating < 1 || rating > 5 {
+		return 0, invalidParam(name, "an integer from 1 to 5")
+	}
+	return rating, nil
+}
+
+func parseTime(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, invalidParam(name, "an RFC 3339 date-time, eg: 2020-01-31T15:04:05Z")
+	}
+	return &t, nil
+}
+
+// ParseFilters reads the filters from the query parameters of a request
+func ParseFilters(query url.Values) (ReviewFilters, error) {
+	var f ReviewFilters
+	var err error
+
+	if f.MaxRating, err = parseRating(query, "maxRating"); err != nil {
+		return f, err
+	}
+	if f.MinRating, err = parseRating(query, "minRating"); err != nil {
+		return f, err
+	}
+	f.UserID = query.Get("userId")
+	f.StallID = query.Get("stallId")
+
+	if value := query.Get("anonymous"); value != "" {
+		anonymous, err := strconv.ParseBool(value)
+		if err != nil {
+			return f, invalidParam("anonymous", "true or false")
+		}
+		f.Anonymous = &anonymous
+	}
+
+	if f.CreatedBefore, err = parseTime(query, "createdBefore"); err != nil {
+		return f, err
+	}
+	if f.CreatedAfter, err = parseTime(query, "createdAfter"); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// The fields reviews can be sorted by
+var sortFields = map[string]func(a, b Review) int{
+	"rating": func(a, b Review) int {
+		return a.Rating - b.Rating
+	},
+	// Helpfulness is how many more voters found a review helpful than didn't
+	"helpful": func(a, b Review) int {
+		return (a.Helpful - a.Unhelpful) - (b.Helpful - b.Unhelpful)
+	},
+	"createdAt": func(a, b Review) int {
+		switch {
+		case a.CreatedAt.Before(b.CreatedAt):
+			return -1
+		case a.CreatedAt.After(b.CreatedAt):
+			return 1
+		}
+		return 0
+	},
+}
+
+// DEFAULT_SORT is oldest first
+const DEFAULT_SORT = "createdAt"
+
+// ParseSort turns a sort parameter such as -rating,createdAt into a less
+// function. A leading - sorts that field in descending order. Ties are
+// broken by uuid, so the order is always stable.
+func ParseSort(value string) (func(a, b Review) bool, error) {
+	if value == "" {
+		value = DEFAULT_SORT
+	}
+
+	type key struct {
+		compare    func(a, b Review) int
+		descending bool
+	}
+	keys := []key{}
+	for _, field := range strings.Split(value, ",") {
+		k := key{}
+		if strings.HasPrefix(field, "-") {
+			k.descending = true
+			field = field[1:]
+		}
+		compare, ok := sortFields[field]
+		if !ok {
+			return nil, invalidParam("sort", "a comma separated list of rating, helpful or createdAt, each optionally prefixed with -")
+		}
+		k.compare = compare
+		keys = append(keys, k)
+	}
+
+	return func(a, b Review) bool {
+		for _, k := range keys {
+			c := k.compare(a, b)
+			if k.descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return ByUuid(a, b)
+	}, nil
+}
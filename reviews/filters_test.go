@@ -0,0 +1,88 @@
+package reviews
+
+import (
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestParseFilters(t *testing.T) {
+	query, _ := url.ParseQuery("minRating=2&maxRating=4&userId=abc&anonymous=false&createdAfter=2020-01-01T00:00:00Z")
+	f, err := ParseFilters(query)
+	assert.NilError(t, err, "should have no errors")
+	assert.Assert(t, is.Equal(f.MinRating, 2))
+	assert.Assert(t, is.Equal(f.MaxRating, 4))
+	assert.Assert(t, is.Equal(f.UserID, "abc"))
+	assert.Assert(t, is.Equal(*f.Anonymous, false))
+	assert.Assert(t, f.CreatedBefore == nil, "should leave out missing filters")
+	assert.Assert(t, f.CreatedAfter.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestParseFiltersNamesInvalidParameter(t *testing.T) {
+	for query, param := range map[string]string{
+		"maxRating=abc":          "maxRating",
+		"minRating=6":            "minRating",
+		"anonymous=maybe":        "anonymous",
+		"createdBefore=tomorrow": "createdBefore",
+	} {
+		values, _ := url.ParseQuery(query)
+		_, err := ParseFilters(values)
+		assert.ErrorContains(t, err, "/invalid-request", query)
+		assert.ErrorContains(t, err, "Query parameter, "+param+",", query)
+	}
+}
+
+func TestMatchAnonymous(t *testing.T) {
+	yes := true
+	f := ReviewFilters{Anonymous: &yes}
+	assert.Assert(t, f.Match(Review{}), "should match reviews without an author")
+	assert.Assert(t, !f.Match(Review{UserID: "abc"}), "should not match reviews with an author")
+}
+
+func TestParseSort(t *testing.T) {
+	start := time.Now()
+	list := []Review{
+		{Uuid: "a", Rating: 3, CreatedAt: start.Add(2 * time.Second)},
+		{Uuid: "b", Rating: 5, CreatedAt: start.Add(1 * time.Second)},
+		{Uuid: "c", Rating: 3, CreatedAt: start},
+		{Uuid: "d", Rating: 5, CreatedAt: start.Add(1 * time.Second)},
+	}
+
+	less, err := ParseSort("-rating,createdAt")
+	assert.NilError(t, err, "should have no errors")
+	sort.Slice(list, func(i, j int) bool { return less(list[i], list[j]) })
+
+	order := ""
+	for _, r := range list {
+		order += r.Uuid
+	}
+	assert.Assert(t, is.Equal(order, "bdca"), "should sort by rating descending, then oldest first, then uuid")
+}
+
+func TestParseSortHelpful(t *testing.T) {
+	list := []Review{
+		{Uuid: "a", Helpful: 1},
+		{Uuid: "b", Helpful: 4, Unhelpful: 1},
+		{Uuid: "c", Helpful: 5, Unhelpful: 4},
+		{Uuid: "d"},
+	}
+
+	less, err := ParseSort("-helpful")
+	assert.NilError(t, err, "should have no errors")
+	sort.Slice(list, func(i, j int) bool { return less(list[i], list[j]) })
+
+	order := ""
+	for _, r := range list {
+		order += r.Uuid
+	}
+	assert.Assert(t, is.Equal(order, "bacd"), "should sort by helpful less unhelpful votes, most first")
+}
+
+func TestParseSortUnknownField(t *testing.T) {
+	_, err := ParseSort("message")
+	assert.ErrorContains(t, err, "Query parameter, sort,")
+}
@@ -0,0 +1,64 @@
+package reviews
+
+import (
+	"bytes"
+	"farmstall/problems"
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Limits on the length of a message, counted in characters. Zero means no limit.
+type Limits struct {
+	Min int
+	Max int
+}
+
+// MessageLimits are checked by AddReview and UpdateReview, in every store
+var MessageLimits = Limits{Min: 0, Max: 2000}
+
+func checkMessage(message string) error {
+	length := utf8.RuneCountInString(message)
+	if MessageLimits.Min != 0 && length < MessageLimits.Min {
+		return problems.InvalidBody(problems.ProblemJson{
+			Detail: fmt.Sprintf("The message is %d characters, it must be at least %d", length, MessageLimits.Min),
+		})
+	}
+	if MessageLimits.Max != 0 && length > MessageLimits.Max {
+		return problems.InvalidBody(problems.ProblemJson{
+			Detail: fmt.Sprintf("The message is %d characters, it may be at most %d", length, MessageLimits.Max),
+		})
+	}
+	return nil
+}
+
+// Raw HTML in a message is left out by goldmark, which only renders it when
+// told it is safe to
+var markdown = goldmark.New(goldmark.WithExtensions(extension.Strikethrough, extension.Linkify))
+
+// Whatever goldmark makes of a message still goes through this allowlist.
+// Images are left out, so a review can't pull in anything from elsewhere.
+var sanitiser = func() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "hr", "em", "strong", "del", "code", "pre", "blockquote",
+		"ul", "ol", "li", "h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowStandardURLs()
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}()
+
+// RenderMessage turns a Markdown message into HTML that is safe to put
+// straight into a page
+func RenderMessage(message string) string {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(message), &buf); err != nil {
+		return "<p>" + html.EscapeString(message) + "</p>"
+	}
+	return strings.TrimSpace(sanitiser.Sanitize(buf.String()))
+}
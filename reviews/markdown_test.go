@@ -0,0 +1,66 @@
+package reviews
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestRenderMessage(t *testing.T) {
+	html := RenderMessage("Fresh *mangoes* and **honey**, see https://example.com")
+	assert.Assert(t, is.Contains(html, "<em>mangoes</em>"), "should render emphasis")
+	assert.Assert(t, is.Contains(html, "<strong>honey</strong>"), "should render strong")
+	assert.Assert(t, is.Contains(html, `href="https://example.com"`), "should link bare urls")
+}
+
+func TestRenderMessageSanitises(t *testing.T) {
+	for _, message := range []string{
+		`<script>alert(1)</script>`,
+		`<img src=x onerror=alert(1)>`,
+		`[click](javascript:alert(1))`,
+		`![pixel](https://example.com/track.gif)`,
+		`<a href="https://example.com" onclick="alert(1)">hi</a>`,
+	} {
+		html := RenderMessage(message)
+		for _, bad := range []string{"<script", "<img", "javascript:", "onerror", "onclick"} {
+			assert.Assert(t, !strings.Contains(html, bad), "%q rendered as %q", message, html)
+		}
+	}
+}
+
+func TestMessageHtmlIsOutputOnly(t *testing.T) {
+	data, _ := json.Marshal(Review{Message: "*hi*", MessageHTML: "<p><em>hi</em></p>"})
+	var doc map[string]interface{}
+	json.Unmarshal(data, &doc)
+	assert.Assert(t, is.Equal(doc["messageHtml"], "<p><em>hi</em></p>"), "should include it once rendered")
+
+	var review Review
+	assert.NilError(t, json.Unmarshal([]byte(`{"message":"hi","messageHtml":"<script></script>"}`), &review))
+	assert.Assert(t, is.Equal(review.MessageHTML, ""), "should ignore messageHtml from clients")
+
+	data, _ = json.Marshal(Review{Message: "hi"})
+	assert.Assert(t, !strings.Contains(string(data), "messageHtml"), "should leave it out unless rendered")
+}
+
+func TestMessageLimits(t *testing.T) {
+	defer func(limits Limits) { MessageLimits = limits }(MessageLimits)
+	MessageLimits = Limits{Min: 2, Max: 5}
+
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		_, err := reviews.AddReview(Review{Message: "a", Rating: 3})
+		assert.ErrorContains(t, err, "at least 2")
+		_, err = reviews.AddReview(Review{Message: "far too long", Rating: 3})
+		assert.ErrorContains(t, err, "at most 5")
+
+		added, err := reviews.AddReview(Review{Message: "ñandú", Rating: 3})
+		assert.NilError(t, err, "should count characters, not bytes")
+		_, err = reviews.UpdateReview(added.Uuid, Review{Message: "far too long", Rating: 3}, ANY_VERSION)
+		assert.ErrorContains(t, err, "/invalid-request-body")
+
+		gotten, _ := reviews.GetReview(added.Uuid)
+		assert.Assert(t, is.Equal(gotten.Version, 1), "should leave the review alone")
+	})
+}
@@ -0,0 +1,104 @@
+package reviews
+
+import (
+	"farmstall/utils"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Statuses of a review. Only published reviews are listed and counted, the
+// rest are left to moderators.
+const (
+	PUBLISHED = "published"
+	// Waiting for a moderator, eg: anonymous reviews under pre-moderation
+	PENDING  = "pending"
+	HIDDEN   = "hidden"
+	REJECTED = "rejected"
+)
+
+// Flag is a report that a review needs a moderator's attention
+type Flag struct {
+	Uuid     string `json:"uuid"`
+	ReviewID string `json:"reviewId"`
+	Reason   string `json:"reason"`
+	// Who reported it, told apart like voters, so reporting the same review
+	// again replaces the reason
+	Reporter  string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// NewFlag is what clients send to report a review
+type NewFlag struct {
+	Reason string `json:"reason"`
+}
+
+// QueueItem is a review waiting for a moderator, with the reports against it
+type QueueItem struct {
+	Review Review `json:"review"`
+	Flags  []Flag `json:"flags"`
+}
+
+// The queue is oldest review first
+func byCreatedAt(a, b QueueItem) bool {
+	if !a.Review.CreatedAt.Equal(b.Review.CreatedAt) {
+		return a.Review.CreatedAt.Before(b.Review.CreatedAt)
+	}
+	return ByUuid(a.Review, b.Review)
+}
+
+func (rs *Reviews) AddFlag(reviewId string, flag Flag) (*Flag, error) {
+	flag.Uuid = uuid.New().String()
+	flag.ReviewID = reviewId
+	flag.CreatedAt = utils.Now()
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if err := rs.liveReview(reviewId); err != nil {
+		return nil, err
+	}
+	flags := rs.Flags[reviewId]
+	for i, existing := range flags {
+		if existing.Reporter == flag.Reporter {
+			flags = append(flags[:i:i], flags[i+1:]...)
+			break
+		}
+	}
+	rs.Flags[reviewId] = append(flags, flag)
+	return &flag, nil
+}
+
+func (rs *Reviews) GetQueue() (*[]QueueItem, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	v := []QueueItem{}
+	for id, review := range rs.Reviews {
+		flags := rs.Flags[id]
+		if review.DeletedAt != nil || (review.Status != PENDING && len(flags) == 0) {
+			continue
+		}
+		item := QueueItem{Review: review, Flags: make([]Flag, len(flags))}
+		copy(item.Flags, flags)
+		v = append(v, item)
+	}
+	sort.Slice(v, func(i, j int) bool { return byCreatedAt(v[i], v[j]) })
+	return &v, nil
+}
+
+func (rs *Reviews) Moderate(reviewId string, status string) (*Review, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if err := rs.liveReview(reviewId); err != nil {
+		return nil, err
+	}
+	review := rs.Reviews[reviewId]
+	rs.tally(review, -1)
+	review.Status = status
+	rs.tally(review, 1)
+	rs.Reviews[reviewId] = review
+	delete(rs.Flags, reviewId)
+	return &review, nil
+}
@@ -0,0 +1,103 @@
+package reviews
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestPendingReviewsAreHidden(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		published, _ := reviews.AddReview(Review{Message: "good", Rating: 5})
+		assert.Assert(t, is.Equal(published.Status, PUBLISHED), "should publish by default")
+		pending, err := reviews.AddReview(Review{Message: "buy my stuff", Rating: 1, Status: PENDING})
+		assert.NilError(t, err, "should have no errors")
+
+		all, _ := reviews.GetReviews()
+		assert.Assert(t, is.Len(*all, 1), "should only list published reviews")
+		filtered, _ := reviews.GetReviewsFiltered(ReviewFilters{MaxRating: 1})
+		assert.Assert(t, is.Len(*filtered, 0), "should only list published reviews")
+		stats, _ := reviews.GetStats(ReviewFilters{})
+		assert.Assert(t, is.Equal(stats.Count, 1), "should only count published reviews")
+
+		gotten, err := reviews.GetReview(pending.Uuid)
+		assert.NilError(t, err, "should still get it by id")
+		assert.Assert(t, is.Equal(gotten.Status, PENDING))
+
+		updated, _ := reviews.UpdateReview(pending.Uuid, Review{Message: "please", Rating: 2, Status: PUBLISHED}, ANY_VERSION)
+		assert.Assert(t, is.Equal(updated.Status, PENDING), "should not publish itself")
+	})
+}
+
+func TestModerate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		pending, _ := reviews.AddReview(Review{Message: "first visit", Rating: 4, Status: PENDING})
+
+		approved, err := reviews.Moderate(pending.Uuid, PUBLISHED)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(approved.Status, PUBLISHED))
+		assert.Assert(t, is.Equal(approved.Version, 1), "should not change the version")
+		stats, _ := reviews.GetStats(ReviewFilters{})
+		assert.Assert(t, is.Equal(stats.Count, 1), "should count it once approved")
+
+		reviews.Moderate(pending.Uuid, HIDDEN)
+		all, _ := reviews.GetReviews()
+		assert.Assert(t, is.Len(*all, 0), "should stop listing hidden reviews")
+		stats, _ = reviews.GetStats(ReviewFilters{MinRating: 4})
+		assert.Assert(t, is.Equal(stats.Count, 0), "should stop counting hidden reviews")
+
+		_, err = reviews.Moderate(uuid.New().String(), REJECTED)
+		assert.ErrorContains(t, err, "/not-found")
+	})
+}
+
+func TestModerationQueue(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		reviews.AddReview(Review{Message: "fine", Rating: 3})
+		pending, _ := reviews.AddReview(Review{Message: "new", Rating: 4, Status: PENDING})
+		time.Sleep(time.Millisecond)
+		flagged, _ := reviews.AddReview(Review{Message: "rude", Rating: 1})
+
+		flag, err := reviews.AddFlag(flagged.Uuid, Flag{Reason: "Abusive", Reporter: "anon:1"})
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(flag.ReviewID, flagged.Uuid))
+		reviews.AddFlag(flagged.Uuid, Flag{Reason: "Spam", Reporter: "user:bob"})
+		reviews.AddFlag(flagged.Uuid, Flag{Reason: "Very abusive", Reporter: "anon:1"})
+
+		queue, err := reviews.GetQueue()
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Len(*queue, 2), "should list pending and flagged reviews")
+		assert.Assert(t, is.Equal((*queue)[0].Review.Uuid, pending.Uuid), "should list the oldest first")
+		assert.Assert(t, is.Len((*queue)[0].Flags, 0))
+		flags := (*queue)[1].Flags
+		assert.Assert(t, is.Len(flags, 2), "should keep one flag per reporter")
+		assert.Assert(t, is.Equal(flags[1].Reason, "Very abusive"), "should replace the earlier report")
+
+		reviews.Moderate(flagged.Uuid, PUBLISHED)
+		reviews.Moderate(pending.Uuid, REJECTED)
+		queue, _ = reviews.GetQueue()
+		assert.Assert(t, is.Len(*queue, 0), "should leave the queue once moderated")
+	})
+}
+
+func TestFlagsFollowTheirReview(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		_, err := reviews.AddFlag(uuid.New().String(), Flag{Reason: "?", Reporter: "anon:1"})
+		assert.ErrorContains(t, err, "/not-found")
+
+		added, _ := reviews.AddReview(Review{Message: "rude", Rating: 1})
+		reviews.AddFlag(added.Uuid, Flag{Reason: "Abusive", Reporter: "anon:1"})
+		reviews.DeleteReview(added.Uuid, ANY_VERSION)
+		queue, _ := reviews.GetQueue()
+		assert.Assert(t, is.Len(*queue, 0), "should leave trashed reviews out of the queue")
+		_, err = reviews.AddFlag(added.Uuid, Flag{Reason: "Abusive", Reporter: "anon:2"})
+		assert.ErrorContains(t, err, "/gone")
+
+		reviews.UndeleteReview(added.Uuid)
+		queue, _ = reviews.GetQueue()
+		assert.Assert(t, is.Len(*queue, 1), "should come back with the review")
+	})
+}
@@ -0,0 +1,68 @@
+package reviews
+
+import (
+	"encoding/json"
+	"farmstall/cursor"
+	"sort"
+	"time"
+)
+
+// Page is one slice of a sorted list of reviews
+type Page struct {
+	Reviews []Review
+	cursor.Links
+}
+
+// The sort keys of a review, for every order ParseSort knows
+type key struct {
+	Uuid      string    `json:"u"`
+	Rating    int       `json:"r"`
+	CreatedAt time.Time `json:"c"`
+	Helpful   int       `json:"h,omitempty"`
+	Unhelpful int       `json:"n,omitempty"`
+}
+
+type sorted struct {
+	reviews []Review
+	less    func(a, b Review) bool
+}
+
+func (s sorted) Len() int { return len(s.reviews) }
+
+func (s sorted) Key(i int) interface{} {
+	r := s.reviews[i]
+	return key{Uuid: r.Uuid, Rating: r.Rating, CreatedAt: r.CreatedAt, Helpful: r.Helpful, Unhelpful: r.Unhelpful}
+}
+
+func (s sorted) Locate(data []byte) (func(i int) bool, func(i int) bool, error) {
+	var k key
+	if err := json.Unmarshal(data, &k); err != nil || k.Uuid == "" {
+		return nil, nil, cursor.ErrInvalid
+	}
+	pivot := Review{Uuid: k.Uuid, Rating: k.Rating, CreatedAt: k.CreatedAt, Helpful: k.Helpful, Unhelpful: k.Unhelpful}
+	before := func(i int) bool { return s.less(s.reviews[i], pivot) }
+	after := func(i int) bool { return s.less(pivot, s.reviews[i]) }
+	return before, after, nil
+}
+
+// ByUuid never changes between calls, so it breaks ties in every sort
+func ByUuid(a, b Review) bool {
+	return a.Uuid < b.Uuid
+}
+
+// Paginate sorts list with less, which must be a total order, and returns
+// the page of at most limit reviews found at cursor. An empty cursor is the
+// first page and a limit of zero means no limit.
+func Paginate(list []Review, less func(a, b Review) bool, limit int, after string) (*Page, error) {
+	s := sorted{reviews: make([]Review, len(list)), less: less}
+	copy(s.reviews, list)
+	sort.SliceStable(s.reviews, func(i, j int) bool {
+		return less(s.reviews[i], s.reviews[j])
+	})
+
+	page, err := cursor.Paginate(s, limit, after)
+	if err != nil {
+		return nil, err
+	}
+	return &Page{Reviews: s.reviews[page.Start:page.End], Links: page.Links}, nil
+}
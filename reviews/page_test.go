@@ -0,0 +1,96 @@
+package reviews
+
+import (
+	"farmstall/cursor"
+	"fmt"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func tenReviews() []Review {
+	list := []Review{}
+	// Out of order, to make sure they get sorted
+	for _, i := range []int{3, 9, 0, 5, 1, 7, 2, 8, 4, 6} {
+		list = append(list, Review{
+			Uuid:    fmt.Sprintf("uuid-%d", i),
+			Message: fmt.Sprintf("review %d", i),
+			Rating:  i%5 + 1,
+		})
+	}
+	return list
+}
+
+func uuids(page *Page) []string {
+	v := []string{}
+	for _, r := range page.Reviews {
+		v = append(v, r.Uuid)
+	}
+	return v
+}
+
+func TestPaginateWithoutLimit(t *testing.T) {
+	page, err := Paginate(tenReviews(), ByUuid, 0, "")
+	assert.NilError(t, err, "should have no errors")
+	assert.Assert(t, is.Len(page.Reviews, 10), "should return everything")
+	assert.Assert(t, is.Equal(page.Reviews[0].Uuid, "uuid-0"), "should be sorted")
+	assert.Assert(t, is.Equal(page.Next, ""), "should have no next page")
+	assert.Assert(t, is.Equal(page.Prev, ""), "should have no prev page")
+}
+
+func TestPaginateForwardsAndBack(t *testing.T) {
+	list := tenReviews()
+
+	first, _ := Paginate(list, ByUuid, 4, "")
+	assert.Assert(t, is.DeepEqual(uuids(first), []string{"uuid-0", "uuid-1", "uuid-2", "uuid-3"}))
+	assert.Assert(t, is.Equal(first.Prev, ""), "should have no prev page")
+
+	second, _ := Paginate(list, ByUuid, 4, first.Next)
+	assert.Assert(t, is.DeepEqual(uuids(second), []string{"uuid-4", "uuid-5", "uuid-6", "uuid-7"}))
+
+	third, _ := Paginate(list, ByUuid, 4, second.Next)
+	assert.Assert(t, is.DeepEqual(uuids(third), []string{"uuid-8", "uuid-9"}))
+	assert.Assert(t, is.Equal(third.Next, ""), "should have no next page")
+
+	back, _ := Paginate(list, ByUuid, 4, third.Prev)
+	assert.Assert(t, is.DeepEqual(uuids(back), uuids(second)), "should go back to the second page")
+
+	backAgain, _ := Paginate(list, ByUuid, 4, back.Prev)
+	assert.Assert(t, is.DeepEqual(uuids(backAgain), uuids(first)), "should go back to the first page")
+}
+
+func TestPaginateAfterDeletedReview(t *testing.T) {
+	list := tenReviews()
+	first, _ := Paginate(list, ByUuid, 3, "")
+
+	// Drop uuid-2, the last review of the first page
+	remaining := []Review{}
+	for _, r := range list {
+		if r.Uuid != "uuid-2" {
+			remaining = append(remaining, r)
+		}
+	}
+
+	second, err := Paginate(remaining, ByUuid, 3, first.Next)
+	assert.NilError(t, err, "should have no errors")
+	assert.Assert(t, is.DeepEqual(uuids(second), []string{"uuid-3", "uuid-4", "uuid-5"}), "should carry on after the deleted review")
+}
+
+func TestPaginateInvalidCursor(t *testing.T) {
+	_, err := Paginate(tenReviews(), ByUuid, 3, "not a cursor")
+	assert.Equal(t, err, cursor.ErrInvalid)
+}
+
+func TestPaginateByHelpful(t *testing.T) {
+	list := tenReviews()
+	for i := range list {
+		list[i].Helpful = i
+	}
+	less, _ := ParseSort("-helpful")
+
+	first, _ := Paginate(list, less, 5, "")
+	second, err := Paginate(list, less, 5, first.Next)
+	assert.NilError(t, err, "should have no errors")
+	assert.Assert(t, is.DeepEqual(uuids(second), []string{"uuid-1", "uuid-5", "uuid-0", "uuid-9", "uuid-3"}), "should carry on from the cursor's votes")
+}
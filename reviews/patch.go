@@ -0,0 +1,90 @@
+package reviews
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+
+	"farmstall/problems"
+
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+// Media types accepted by PATCH
+const (
+	MERGE_PATCH = "application/merge-patch+json" // RFC 7396
+	JSON_PATCH  = "application/json-patch+json"  // RFC 6902
+)
+
+// Fields of a review that only the server may change
+var readOnlyFields = []string{"uuid", "userId", "createdAt", "updatedAt", "updatedBy", "version", "messageHtml", "helpful", "unhelpful", "status", "deletedAt"}
+
+// ApplyPatch returns a copy of r with a merge patch or a JSON patch applied,
+// depending on contentType. The patched review is passed to validate, as a
+// decoded JSON document, before it is returned.
+func ApplyPatch(r Review, contentType string, patch []byte, validate func(doc interface{}) error) (*Review, error) {
+	instance := BASE_PATH + "/" + r.Uuid
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	original, _ := json.Marshal(r)
+
+	var patched []byte
+	var err error
+	switch mediaType {
+	case MERGE_PATCH:
+		patched, err = jsonpatch.MergePatch(original, patch)
+	case JSON_PATCH:
+		var ops jsonpatch.Patch
+		ops, err = jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, problems.FailedToParseJson(problems.ProblemJson{
+				Instance: instance,
+				Detail:   err.Error(),
+			})
+		}
+		patched, err = ops.Apply(original)
+	default:
+		return nil, problems.UnsupportedMediaType(problems.ProblemJson{
+			Instance: instance,
+			Detail:   fmt.Sprintf("Content-Type must be %s or %s", MERGE_PATCH, JSON_PATCH),
+		})
+	}
+	if err != nil {
+		return nil, problems.PatchFailed(problems.ProblemJson{
+			Instance: instance,
+			Detail:   err.Error(),
+		})
+	}
+
+	var before, after map[string]interface{}
+	json.Unmarshal(original, &before)
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return nil, problems.PatchFailed(problems.ProblemJson{
+			Instance: instance,
+			Detail:   "The patched review must be a JSON object",
+		})
+	}
+	for _, field := range readOnlyFields {
+		if fmt.Sprint(before[field]) != fmt.Sprint(after[field]) {
+			return nil, problems.PatchFailed(problems.ProblemJson{
+				Instance: instance,
+				Detail:   fmt.Sprintf("%s is read-only", field),
+			})
+		}
+	}
+	if err := validate(after); err != nil {
+		return nil, problems.PatchFailed(problems.ProblemJson{
+			Instance: instance,
+			Detail:   "The patched review is invalid: " + err.Error(),
+		})
+	}
+
+	var result Review
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return nil, problems.PatchFailed(problems.ProblemJson{
+			Instance: instance,
+			Detail:   err.Error(),
+		})
+	}
+	return &result, nil
+}
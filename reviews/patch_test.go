@@ -0,0 +1,63 @@
+package reviews
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func noValidation(doc interface{}) error {
+	return nil
+}
+
+func original() Review {
+	return Review{
+		Uuid:    "f7f680a8-d111-421f-b6b3-493ebf905078",
+		Message: "poor",
+		Rating:  1,
+	}
+}
+
+func TestMergePatchKeepsOmittedFields(t *testing.T) {
+	patched, err := ApplyPatch(original(), MERGE_PATCH, []byte(`{"rating": 4}`), noValidation)
+	assert.NilError(t, err, "should have no errors")
+	assert.Assert(t, is.Equal(patched.Rating, 4), "should change the rating")
+	assert.Assert(t, is.Equal(patched.Message, "poor"), "should keep the message")
+}
+
+func TestJSONPatch(t *testing.T) {
+	patch := `[
+		{"op": "test", "path": "/rating", "value": 1},
+		{"op": "replace", "path": "/message", "value": "better"}
+	]`
+	patched, err := ApplyPatch(original(), JSON_PATCH+"; charset=utf-8", []byte(patch), noValidation)
+	assert.NilError(t, err, "should have no errors")
+	assert.Assert(t, is.Equal(patched.Message, "better"), "should change the message")
+	assert.Assert(t, is.Equal(patched.Rating, 1), "should keep the rating")
+}
+
+func TestJSONPatchFailedTest(t *testing.T) {
+	patch := `[{"op": "test", "path": "/rating", "value": 5}]`
+	_, err := ApplyPatch(original(), JSON_PATCH, []byte(patch), noValidation)
+	assert.ErrorContains(t, err, "/patch-failed")
+}
+
+func TestPatchReadOnlyField(t *testing.T) {
+	_, err := ApplyPatch(original(), MERGE_PATCH, []byte(`{"uuid": "something-else"}`), noValidation)
+	assert.ErrorContains(t, err, "uuid is read-only")
+}
+
+func TestPatchInvalidResult(t *testing.T) {
+	invalid := func(doc interface{}) error {
+		return errors.New("rating must be at most 5")
+	}
+	_, err := ApplyPatch(original(), MERGE_PATCH, []byte(`{"rating": 9}`), invalid)
+	assert.ErrorContains(t, err, "The patched review is invalid: rating must be at most 5")
+}
+
+func TestPatchUnsupportedMediaType(t *testing.T) {
+	_, err := ApplyPatch(original(), "application/json", []byte(`{"rating": 4}`), noValidation)
+	assert.ErrorContains(t, err, "/unsupported-media-type")
+}
@@ -0,0 +1,134 @@
+package reviews
+
+import (
+	"farmstall/problems"
+	"farmstall/utils"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reply is a response to a review, eg: from the owner of the stall it is
+// about. Replies are one level deep, there are no replies to replies.
+type Reply struct {
+	Uuid     string `json:"uuid"`
+	ReviewID string `json:"reviewId"`
+	Message  string `json:"message"`
+	// Replies always have an author
+	UserID    string    `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// The message rendered by RenderMessage, only filled in when a client asks for it
+	MessageHTML string `json:"messageHtml,omitempty"`
+}
+
+// NewReply is what clients send to create or replace a reply
+type NewReply struct {
+	Message string `json:"message"`
+}
+
+func replyNotFound(reviewId, replyId string) error {
+	return problems.NotFound(problems.ProblemJson{
+		Instance: BASE_PATH + "/" + reviewId + "/replies/" + replyId,
+	})
+}
+
+// The review a reply belongs to must be live. Callers must hold rs.mu
+func (rs *Reviews) liveReview(id string) error {
+	review, ok := rs.Reviews[id]
+	if !ok {
+		return problems.NotFound(problems.ProblemJson{
+			Instance: BASE_PATH + "/" + id,
+		})
+	}
+	if review.DeletedAt != nil {
+		return gone(id, review.DeletedAt)
+	}
+	return nil
+}
+
+// Callers must hold rs.mu
+func (rs *Reviews) findReply(reviewId, replyId string) (int, error) {
+	if err := rs.liveReview(reviewId); err != nil {
+		return 0, err
+	}
+	for i, reply := range rs.Replies[reviewId] {
+		if reply.Uuid == replyId {
+			return i, nil
+		}
+	}
+	return 0, replyNotFound(reviewId, replyId)
+}
+
+func (rs *Reviews) AddReply(reviewId string, reply Reply) (*Reply, error) {
+	if err := checkMessage(reply.Message); err != nil {
+		return nil, err
+	}
+	reply.Uuid = uuid.New().String()
+	reply.ReviewID = reviewId
+	reply.CreatedAt = utils.Now()
+	reply.UpdatedAt = reply.CreatedAt
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if err := rs.liveReview(reviewId); err != nil {
+		return nil, err
+	}
+	rs.Replies[reviewId] = append(rs.Replies[reviewId], reply)
+	return &reply, nil
+}
+
+func (rs *Reviews) GetReplies(reviewId string) (*[]Reply, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	if err := rs.liveReview(reviewId); err != nil {
+		return nil, err
+	}
+	v := make([]Reply, len(rs.Replies[reviewId]))
+	copy(v, rs.Replies[reviewId])
+	return &v, nil
+}
+
+func (rs *Reviews) GetReply(reviewId, replyId string) (*Reply, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	i, err := rs.findReply(reviewId, replyId)
+	if err != nil {
+		return nil, err
+	}
+	reply := rs.Replies[reviewId][i]
+	return &reply, nil
+}
+
+func (rs *Reviews) UpdateReply(reviewId, replyId string, reply Reply) (*Reply, error) {
+	if err := checkMessage(reply.Message); err != nil {
+		return nil, err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	i, err := rs.findReply(reviewId, replyId)
+	if err != nil {
+		return nil, err
+	}
+	existing := rs.Replies[reviewId][i]
+	existing.Message = reply.Message
+	existing.UpdatedAt = utils.Now()
+	rs.Replies[reviewId][i] = existing
+	return &existing, nil
+}
+
+func (rs *Reviews) DeleteReply(reviewId, replyId string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	i, err := rs.findReply(reviewId, replyId)
+	if err != nil {
+		return err
+	}
+	replies := rs.Replies[reviewId]
+	rs.Replies[reviewId] = append(replies[:i:i], replies[i+1:]...)
+	return nil
+}
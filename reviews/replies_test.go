@@ -0,0 +1,103 @@
+package reviews
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestAddThenGetReplies(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		review, _ := reviews.AddReview(Review{Message: "Sold out by ten", Rating: 2})
+		owner := uuid.New().String()
+
+		first, err := reviews.AddReply(review.Uuid, Reply{Message: "Sorry, we'll bring more", UserID: owner})
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, first.Uuid != "", "should get a uuid")
+		assert.Assert(t, is.Equal(first.ReviewID, review.Uuid), "should belong to the review")
+		second, _ := reviews.AddReply(review.Uuid, Reply{Message: "Thanks!", UserID: uuid.New().String()})
+
+		replies, err := reviews.GetReplies(review.Uuid)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Len(*replies, 2), "should list every reply")
+		assert.Assert(t, is.DeepEqual((*replies)[0], *first), "should list the oldest first")
+		assert.Assert(t, is.Equal((*replies)[1].Uuid, second.Uuid))
+
+		gotten, err := reviews.GetReply(review.Uuid, first.Uuid)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(gotten.UserID, owner), "should keep the author")
+	})
+}
+
+func TestRepliesNotFound(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		_, err := reviews.AddReply(uuid.New().String(), Reply{Message: "hello?"})
+		assert.ErrorContains(t, err, "/not-found", "should need a review")
+
+		review, _ := reviews.AddReview(Review{Message: "good", Rating: 4})
+		other, _ := reviews.AddReview(Review{Message: "bad", Rating: 1})
+		reply, _ := reviews.AddReply(review.Uuid, Reply{Message: "Thanks"})
+
+		_, err = reviews.GetReply(other.Uuid, reply.Uuid)
+		assert.ErrorContains(t, err, "/not-found", "should only find replies under their own review")
+		_, err = reviews.UpdateReply(review.Uuid, uuid.New().String(), Reply{Message: "edit"})
+		assert.ErrorContains(t, err, "/not-found")
+		assert.ErrorContains(t, reviews.DeleteReply(other.Uuid, reply.Uuid), "/not-found")
+	})
+}
+
+func TestUpdateReply(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		review, _ := reviews.AddReview(Review{Message: "good", Rating: 4})
+		author := uuid.New().String()
+		added, _ := reviews.AddReply(review.Uuid, Reply{Message: "Thanks", UserID: author})
+		time.Sleep(time.Millisecond)
+
+		updated, err := reviews.UpdateReply(review.Uuid, added.Uuid, Reply{Message: "Thanks, see you Saturday", UserID: uuid.New().String()})
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(updated.Message, "Thanks, see you Saturday"), "should change the message")
+		assert.Assert(t, is.Equal(updated.UserID, author), "should keep the author")
+		assert.Assert(t, updated.CreatedAt.Equal(added.CreatedAt), "should keep createdAt")
+		assert.Assert(t, updated.UpdatedAt.After(added.UpdatedAt), "should move updatedAt")
+	})
+}
+
+func TestDeleteReply(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		review, _ := reviews.AddReview(Review{Message: "good", Rating: 4})
+		first, _ := reviews.AddReply(review.Uuid, Reply{Message: "one"})
+		second, _ := reviews.AddReply(review.Uuid, Reply{Message: "two"})
+
+		assert.NilError(t, reviews.DeleteReply(review.Uuid, first.Uuid), "should delete")
+		assert.ErrorContains(t, reviews.DeleteReply(review.Uuid, first.Uuid), "/not-found", "should not delete twice")
+		replies, _ := reviews.GetReplies(review.Uuid)
+		assert.Assert(t, is.Len(*replies, 1), "should leave the others")
+		assert.Assert(t, is.Equal((*replies)[0].Uuid, second.Uuid))
+	})
+}
+
+func TestRepliesFollowTheirReview(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		review, _ := reviews.AddReview(Review{Message: "poor", Rating: 1})
+		reply, _ := reviews.AddReply(review.Uuid, Reply{Message: "Sorry to hear"})
+
+		reviews.DeleteReview(review.Uuid, ANY_VERSION)
+		_, err := reviews.GetReplies(review.Uuid)
+		assert.ErrorContains(t, err, "/gone", "should be gone while the review is in the trash")
+		_, err = reviews.AddReply(review.Uuid, Reply{Message: "Hello?"})
+		assert.ErrorContains(t, err, "/gone", "should not reply to a trashed review")
+
+		reviews.UndeleteReview(review.Uuid)
+		_, err = reviews.GetReply(review.Uuid, reply.Uuid)
+		assert.NilError(t, err, "should come back with the review")
+
+		reviews.DeleteReview(review.Uuid, ANY_VERSION)
+		reviews.PurgeDeleted(time.Now().Add(time.Second))
+		reviews.AddReview(Review{Message: "good", Rating: 5})
+		_, err = reviews.GetReplies(review.Uuid)
+		assert.ErrorContains(t, err, "/not-found", "should be purged with the review")
+	})
+}
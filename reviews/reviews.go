@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"farmstall/problems"
 	"farmstall/utils"
+	"fmt"
 	"github.com/google/uuid"
 	_ "log"
+	"sort"
+	"sync"
+	"time"
 )
 
 const BASE_PATH = "/reviews"
@@ -17,13 +21,41 @@ type Review struct {
 	Rating  int    `json:"rating"`
 	Uuid    string `json:"uuid"`
 	UserID  string `json:"-"`
-}
-type ReviewFilters struct {
-	MaxRating int `json:"maxRating"`
+	// The stall the review is about, empty for general feedback
+	StallID   string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Who made the latest change, empty when it was made anonymously
+	UpdatedBy string `json:"-"`
+	// Starts at 1 and goes up by one with every change
+	Version int `json:"version"`
+	// When the review was moved to the trash, nil while it is live
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// How many voters found the review helpful, or not. Kept by Vote and Unvote.
+	Helpful   int `json:"helpful"`
+	Unhelpful int `json:"unhelpful"`
+	// PUBLISHED, unless a moderator has to look at it. Kept by Moderate.
+	Status string `json:"status"`
+	// The message rendered by RenderMessage, only filled in when a client asks for it
+	MessageHTML string `json:"-"`
 }
 
+// Reviews is the in-memory ReviewStore. It is safe for concurrent use.
 type Reviews struct {
-	Reviews map[string]Review `json:"reviews"`
+	mu        sync.RWMutex
+	Reviews   map[string]Review     `json:"reviews"`
+	Revisions map[string][]Revision `json:"revisions"`
+	// Oldest first, by review
+	Replies map[string][]Reply `json:"replies"`
+	// Whether each voter found a review helpful, by review
+	Votes map[string]map[string]bool `json:"votes"`
+	// Reports waiting for a moderator, by review
+	Flags map[string][]Flag `json:"flags"`
+	// Running totals of the live reviews, for GetStats
+	tallies map[segment]Histogram
+	// The uuids of every review each user wrote, trashed ones included, so
+	// a user's reviews can be listed without going through everyone's
+	byUser map[string]map[string]bool
 }
 
 type DeletedReview struct {
@@ -31,30 +63,106 @@ type DeletedReview struct {
 }
 
 func NewReviews() *Reviews {
-	rs := Reviews{Reviews: ReviewMap{}}
+	rs := Reviews{Reviews: ReviewMap{}, Revisions: map[string][]Revision{}, Replies: map[string][]Reply{}, Votes: map[string]map[string]bool{}, Flags: map[string][]Flag{}, tallies: map[segment]Histogram{}, byUser: map[string]map[string]bool{}}
 	return &rs
 }
 
-func (rs *Reviews) UpdateReview(reviewId string, r Review) (*Review, error) {
-	if _, ok := rs.Reviews[reviewId]; !ok {
+// Returned when a review has changed since the client last fetched it
+func versionMismatch(id string, version int) error {
+	return problems.PreconditionFailed(problems.ProblemJson{
+		Instance: BASE_PATH + "/" + id,
+		Detail:   fmt.Sprintf("The review is at version %d", version),
+	})
+}
+
+func gone(id string, deletedAt *time.Time) error {
+	return problems.Gone(problems.ProblemJson{
+		Instance: BASE_PATH + "/" + id,
+		Detail:   fmt.Sprintf("The review was deleted at %s", deletedAt.Format(time.RFC3339)),
+	})
+}
+
+func notInTrash(id string) error {
+	return problems.NotFound(problems.ProblemJson{
+		Instance: BASE_PATH + "/" + id,
+		Detail:   "The review isn't in the trash",
+	})
+}
+
+// Trashed reviews are listed in the order they were deleted
+func byDeletedAt(a, b Review) bool {
+	if !a.DeletedAt.Equal(*b.DeletedAt) {
+		return a.DeletedAt.Before(*b.DeletedAt)
+	}
+	return ByUuid(a, b)
+}
+
+func (rs *Reviews) UpdateReview(reviewId string, r Review, ifVersion int) (*Review, error) {
+	if err := checkMessage(r.Message); err != nil {
+		return nil, err
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	existing, ok := rs.Reviews[reviewId]
+	if !ok {
 		return nil, problems.UpdateNonExisting(problems.ProblemJson{
 			Instance: BASE_PATH + "/" + reviewId,
 		})
 	}
+	if existing.DeletedAt != nil {
+		return nil, gone(reviewId, existing.DeletedAt)
+	}
+	if ifVersion != ANY_VERSION && ifVersion != existing.Version {
+		return nil, versionMismatch(reviewId, existing.Version)
+	}
 
 	r.Uuid = reviewId
+	r.CreatedAt = existing.CreatedAt
+	r.UpdatedAt = utils.Now()
+	r.Version = existing.Version + 1
+	r.Helpful, r.Unhelpful = existing.Helpful, existing.Unhelpful
+	r.Status = existing.Status
+	r.DeletedAt = existing.DeletedAt
 	rs.Reviews[reviewId] = r
+	rs.unindex(existing)
+	rs.index(r)
+	rs.tally(existing, -1)
+	rs.tally(r, 1)
+	rs.Revisions[reviewId] = append(rs.Revisions[reviewId], revisionOf(r))
 	return &r, nil
 }
 
 func (rs *Reviews) AddReview(r Review) (*Review, error) {
+	if err := checkMessage(r.Message); err != nil {
+		return nil, err
+	}
 	uuidVal := uuid.New().String()
 	r.Uuid = uuidVal
+	r.CreatedAt = utils.Now()
+	r.UpdatedAt = r.CreatedAt
+	r.UpdatedBy = r.UserID
+	r.Version = 1
+	r.Helpful, r.Unhelpful = 0, 0
+	// Only DeleteReview puts a review in the trash
+	r.DeletedAt = nil
+	if r.Status == "" {
+		r.Status = PUBLISHED
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
 	rs.Reviews[uuidVal] = r
+	rs.index(r)
+	rs.tally(r, 1)
+	rs.Revisions[uuidVal] = []Revision{revisionOf(r)}
 	return &r, nil
 }
 
 func (rs *Reviews) GetReview(id string) (*Review, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
 	var review Review
 	var ok bool
 	review, ok = rs.Reviews[id]
@@ -63,56 +171,242 @@ func (rs *Reviews) GetReview(id string) (*Review, error) {
 			Instance: BASE_PATH + "/" + id,
 		})
 	}
+	if review.DeletedAt != nil {
+		return nil, gone(id, review.DeletedAt)
+	}
 	return &review, nil
 }
 
-func (rs *Reviews) DeleteReview(id string) error {
-	if _, ok := rs.Reviews[id]; !ok {
+func (rs *Reviews) DeleteReview(id string, ifVersion int) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	existing, ok := rs.Reviews[id]
+	if !ok {
 		return problems.NotFound(problems.ProblemJson{
 			Instance: BASE_PATH + "/" + id,
 		})
 	}
-	delete(rs.Reviews, id)
+	if existing.DeletedAt != nil {
+		return gone(id, existing.DeletedAt)
+	}
+	if ifVersion != ANY_VERSION && ifVersion != existing.Version {
+		return versionMismatch(id, existing.Version)
+	}
+	deletedAt := utils.Now()
+	existing.DeletedAt = &deletedAt
+	rs.Reviews[id] = existing
+	rs.tally(existing, -1)
 	return nil
 }
 
-func (rs *Reviews) GetReviews() *[]Review {
-	v := make([]Review, 0, len(rs.Reviews))
+func (rs *Reviews) GetTrash() (*[]Review, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	v := []Review{}
 	for _, value := range rs.Reviews {
-		v = append(v, value)
+		if value.DeletedAt != nil {
+			v = append(v, value)
+		}
 	}
-	return &v
+	sort.Slice(v, func(i, j int) bool { return byDeletedAt(v[i], v[j]) })
+	return &v, nil
 }
 
-func (rs *Reviews) GetReviewsFiltered(filters ReviewFilters) *[]Review {
+func (rs *Reviews) UndeleteReview(id string) (*Review, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	review, ok := rs.Reviews[id]
+	if !ok || review.DeletedAt == nil {
+		return nil, notInTrash(id)
+	}
+	review.DeletedAt = nil
+	review.Version++
+	rs.Reviews[id] = review
+	rs.tally(review, 1)
+	return &review, nil
+}
+
+func (rs *Reviews) PurgeDeleted(cutoff time.Time) (int, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	purged := 0
+	for id, review := range rs.Reviews {
+		if review.DeletedAt != nil && review.DeletedAt.Before(cutoff) {
+			delete(rs.Reviews, id)
+			rs.unindex(review)
+			delete(rs.Revisions, id)
+			delete(rs.Replies, id)
+			delete(rs.Votes, id)
+			delete(rs.Flags, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (rs *Reviews) GetReviews() (*[]Review, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
 	v := make([]Review, 0, len(rs.Reviews))
 	for _, value := range rs.Reviews {
-		if value.Rating <= filters.MaxRating {
+		if value.DeletedAt == nil && value.Status == PUBLISHED {
 			v = append(v, value)
 		}
 	}
-	return &v
+	sort.Slice(v, func(i, j int) bool { return ByUuid(v[i], v[j]) })
+	return &v, nil
+}
+
+func (rs *Reviews) GetReviewsFiltered(filters ReviewFilters) (*[]Review, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	v := []Review{}
+	add := func(r Review) {
+		if r.DeletedAt == nil && r.Status == PUBLISHED && filters.Match(r) {
+			v = append(v, r)
+		}
+	}
+	if filters.UserID != "" {
+		for id := range rs.byUser[filters.UserID] {
+			add(rs.Reviews[id])
+		}
+	} else {
+		for _, value := range rs.Reviews {
+			add(value)
+		}
+	}
+	sort.Slice(v, func(i, j int) bool { return ByUuid(v[i], v[j]) })
+	return &v, nil
+}
+
+// Callers must hold rs.mu
+func (rs *Reviews) index(r Review) {
+	if r.UserID == "" {
+		return
+	}
+	if rs.byUser[r.UserID] == nil {
+		rs.byUser[r.UserID] = map[string]bool{}
+	}
+	rs.byUser[r.UserID][r.Uuid] = true
+}
+
+// Callers must hold rs.mu
+func (rs *Reviews) unindex(r Review) {
+	delete(rs.byUser[r.UserID], r.Uuid)
+	if len(rs.byUser[r.UserID]) == 0 {
+		delete(rs.byUser, r.UserID)
+	}
+}
+
+func (rs *Reviews) GetRevisions(id string) (*[]Revision, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	if err := rs.liveReview(id); err != nil {
+		return nil, err
+	}
+	history := rs.Revisions[id]
+	v := make([]Revision, len(history))
+	copy(v, history)
+	return &v, nil
+}
+
+func (rs *Reviews) GetRevision(id string, number int) (*Revision, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	if err := rs.liveReview(id); err != nil {
+		return nil, err
+	}
+	// Undeleting changes the version without a revision, so there can be gaps
+	for _, revision := range rs.Revisions[id] {
+		if revision.Number == number {
+			return &revision, nil
+		}
+	}
+	return nil, revisionNotFound(id, number)
+}
+
+// Only published reviews are counted. Callers must hold rs.mu
+func (rs *Reviews) tally(r Review, delta int) {
+	if r.Status != PUBLISHED {
+		return
+	}
+	h := rs.tallies[segmentOf(r)]
+	h.tally(r.Rating, delta)
+	rs.tallies[segmentOf(r)] = h
+}
+
+func (rs *Reviews) GetStats(filters ReviewFilters) (*Stats, error) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	var h Histogram
+	if filters.bySegment() {
+		for seg, tally := range rs.tallies {
+			if filters.matchSegment(seg) {
+				h.add(tally, filters)
+			}
+		}
+	} else {
+		for _, r := range rs.Reviews {
+			if r.DeletedAt == nil && r.Status == PUBLISHED && filters.Match(r) {
+				h.tally(r.Rating, 1)
+			}
+		}
+	}
+	stats := h.Stats()
+	return &stats, nil
+}
+
+func (rs *Reviews) Clear() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.Reviews = ReviewMap{}
+	rs.Revisions = map[string][]Revision{}
+	rs.Replies = map[string][]Reply{}
+	rs.Votes = map[string]map[string]bool{}
+	rs.Flags = map[string][]Flag{}
+	rs.tallies = map[segment]Histogram{}
+	rs.byUser = map[string]map[string]bool{}
+	return nil
 }
 
 // JSON marshal/unmarshal
-// Allows for UserID to be null
+// Allows for UserID, UpdatedBy and StallID to be null
 
 type ReviewAlias Review
 type ReviewJSON struct {
 	ReviewAlias
-	UserID utils.NullString `json:"userId"`
+	UserID    utils.NullString `json:"userId"`
+	UpdatedBy utils.NullString `json:"updatedBy"`
+	StallID   utils.NullString `json:"stallId"`
+	// Output only, toObj leaves it behind
+	MessageHTML string `json:"messageHtml,omitempty"`
 }
 
 func NewReviewJSON(r Review) ReviewJSON {
 	rj := ReviewJSON{}
 	rj.ReviewAlias = ReviewAlias(r)
 	rj.UserID = utils.NullString(r.UserID)
+	rj.UpdatedBy = utils.NullString(r.UpdatedBy)
+	rj.StallID = utils.NullString(r.StallID)
+	rj.MessageHTML = r.MessageHTML
 	return rj
 }
 
 func (rj ReviewJSON) toObj() Review {
 	r := Review(rj.ReviewAlias)
 	r.UserID = string(rj.UserID)
+	r.UpdatedBy = string(rj.UpdatedBy)
+	r.StallID = string(rj.StallID)
 	return r
 }
 
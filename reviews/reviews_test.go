@@ -1,180 +1,642 @@
 package reviews
 
 import (
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"encoding/json"
+	"farmstall/database"
 	"github.com/google/uuid"
 	"gotest.tools/assert"
 	is "gotest.tools/assert/cmp"
 )
 
+// backends lists every ReviewStore implementation the tests run against
+var backends = map[string]func(t *testing.T) ReviewStore{
+	"memory": func(t *testing.T) ReviewStore {
+		return NewReviews()
+	},
+	"sqlite": func(t *testing.T) ReviewStore {
+		db, err := database.Open(database.SCHEME + filepath.Join(t.TempDir(), "farmstall.db"))
+		assert.NilError(t, err, "should open the database")
+		t.Cleanup(func() { db.Close() })
+		return NewSQLReviews(db)
+	},
+}
+
+func forEachStore(t *testing.T, test func(t *testing.T, reviews ReviewStore)) {
+	for name, newStore := range backends {
+		newStore := newStore
+		t.Run(name, func(t *testing.T) {
+			test(t, newStore(t))
+		})
+	}
+}
+
 func TestGetReviewsEmpty(t *testing.T) {
-	reviews := NewReviews()
-	res := reviews.GetReviews()
-	assert.Assert(t, is.Len(*res, 0), "should return empty list of reviews")
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		res, _ := reviews.GetReviews()
+		assert.Assert(t, is.Len(*res, 0), "should return empty list of reviews")
+	})
 }
 
 func TestAddOneReview(t *testing.T) {
-	reviews := NewReviews()
-	_, err := reviews.AddReview(Review{
-		Message: "good",
-		Rating:  5,
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		_, err := reviews.AddReview(Review{
+			Message: "good",
+			Rating:  5,
+		})
+		assert.NilError(t, err, "should have no errors")
+		allReviews, _ := reviews.GetReviews()
+		assert.Assert(t, is.Len(*allReviews, 1), "should update the list of reviews")
 	})
-	assert.NilError(t, err, "should have no errors")
-	assert.Assert(t, is.Len(reviews.Reviews, 1), "should update the list of reviews")
 }
 
 func TestAddThenGetOneReview(t *testing.T) {
-	reviews := NewReviews()
-	addedReview, err := reviews.AddReview(Review{
-		Message: "good",
-		Rating:  5,
-	})
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		addedReview, err := reviews.AddReview(Review{
+			Message: "good",
+			Rating:  5,
+		})
 
-	gottenReview, err := reviews.GetReview(addedReview.Uuid)
+		gottenReview, err := reviews.GetReview(addedReview.Uuid)
 
-	assert.NilError(t, err, "should have no errors")
-	assert.Assert(t, is.DeepEqual(addedReview, gottenReview), "should match the review in memory")
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.DeepEqual(addedReview, gottenReview), "should match the review in memory")
+	})
 }
 
 func TestAddTwoThenGetAllReviews(t *testing.T) {
-	reviews := NewReviews()
-	reviews.AddReview(Review{
-		Message: "good",
-		Rating:  5,
-	})
-	reviews.AddReview(Review{
-		Message: "poor",
-		Rating:  1,
-	})
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		reviews.AddReview(Review{
+			Message: "good",
+			Rating:  5,
+		})
+		reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+		})
 
-	allReviews := reviews.GetReviews()
-	assert.Assert(t, is.Len(*allReviews, 2), "should match the number of reviews added")
+		allReviews, _ := reviews.GetReviews()
+		assert.Assert(t, is.Len(*allReviews, 2), "should match the number of reviews added")
+	})
 }
 
 func TestDeleteOnReview(t *testing.T) {
-	reviews := NewReviews()
-	addedReview, _ := reviews.AddReview(Review{
-		Message: "good",
-		Rating:  5,
-	})
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		addedReview, _ := reviews.AddReview(Review{
+			Message: "good",
+			Rating:  5,
+		})
 
-	err := reviews.DeleteReview(addedReview.Uuid)
-	assert.NilError(t, err, "should have no errors")
-	assert.Assert(t, is.Len(reviews.Reviews, 0), "should have no reviews")
+		err := reviews.DeleteReview(addedReview.Uuid, ANY_VERSION)
+		assert.NilError(t, err, "should have no errors")
+		allReviews, _ := reviews.GetReviews()
+		assert.Assert(t, is.Len(*allReviews, 0), "should have no reviews")
+	})
 }
 
 func TestUpdateReview(t *testing.T) {
-	reviews := NewReviews()
-	oriReview, _ := reviews.AddReview(Review{
-		Message: "poor",
-		Rating:  1,
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		oriReview, _ := reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+		})
+
+		newReview := Review{
+			Message: "good",
+			Rating:  5,
+		}
+
+		_, err := reviews.UpdateReview(oriReview.Uuid, newReview, ANY_VERSION)
+		assert.NilError(t, err, "should have no errors")
+
+		updatedReview, err := reviews.GetReview(oriReview.Uuid)
+		assert.NilError(t, err, "should have no errors")
+
+		assert.Assert(t, is.Equal(updatedReview.Message, "good"), "should match the updated review's Message")
+		assert.Assert(t, is.Equal(updatedReview.Rating, 5), "should match the updated review's Rating")
+		allReviews, _ := reviews.GetReviews()
+		assert.Assert(t, is.Len(*allReviews, 1), "should not add any more reviews")
 	})
+}
 
-	newReview := Review{
-		Message: "good",
-		Rating:  5,
-	}
+func TestTimestampsAreServerManaged(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		past := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		added, _ := reviews.AddReview(Review{
+			Message:   "poor",
+			Rating:    1,
+			CreatedAt: past,
+			UpdatedAt: past,
+		})
+		assert.Assert(t, added.CreatedAt.After(past), "should ignore the given createdAt")
+		assert.Assert(t, added.UpdatedAt.Equal(added.CreatedAt), "should start with updatedAt equal to createdAt")
 
-	_, err := reviews.UpdateReview(oriReview.Uuid, newReview)
-	assert.NilError(t, err, "should have no errors")
+		time.Sleep(time.Millisecond)
+		updated, err := reviews.UpdateReview(added.Uuid, Review{
+			Message:   "good",
+			Rating:    5,
+			CreatedAt: past,
+			UpdatedAt: past,
+		}, ANY_VERSION)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, updated.CreatedAt.Equal(added.CreatedAt), "should keep the original createdAt")
+		assert.Assert(t, updated.UpdatedAt.After(added.UpdatedAt), "should move updatedAt forward")
 
-	updatedReview, err := reviews.GetReview(oriReview.Uuid)
-	assert.NilError(t, err, "should have no errors")
+		gotten, _ := reviews.GetReview(added.Uuid)
+		assert.Assert(t, gotten.UpdatedAt.Equal(updated.UpdatedAt), "should store updatedAt")
+	})
+}
 
-	assert.Assert(t, is.Equal(updatedReview.Message, "good"), "should match the updated review's Message")
-	assert.Assert(t, is.Equal(updatedReview.Rating, 5), "should match the updated review's Rating")
-	assert.Assert(t, is.Len(reviews.Reviews, 1), "should not add any more reviews")
+func TestVersions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		added, _ := reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+			Version: 7,
+		})
+		assert.Assert(t, is.Equal(added.Version, 1), "should start at version 1")
+
+		updated, err := reviews.UpdateReview(added.Uuid, Review{
+			Message: "good",
+			Rating:  5,
+		}, 1)
+		assert.NilError(t, err, "should update when the version matches")
+		assert.Assert(t, is.Equal(updated.Version, 2), "should bump the version")
+
+		gotten, _ := reviews.GetReview(added.Uuid)
+		assert.Assert(t, is.Equal(gotten.Version, 2), "should store the version")
+	})
 }
 
-func TestUpdateReviewInvalidUuid(t *testing.T) {
-	reviews := NewReviews()
-	newReview := Review{
-		Message: "good",
-		Rating:  5,
-		Uuid:    uuid.New().String(),
-	}
-	_, err := reviews.UpdateReview(newReview.Uuid, newReview)
-	assert.ErrorContains(t, err, "Refusing to update a non-existing resource", "should return an error")
+func TestStaleVersion(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		added, _ := reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+		})
+		reviews.UpdateReview(added.Uuid, Review{Message: "better", Rating: 3}, ANY_VERSION)
+
+		_, err := reviews.UpdateReview(added.Uuid, Review{Message: "good", Rating: 5}, added.Version)
+		assert.ErrorContains(t, err, "/precondition-failed", "should refuse a stale update")
+		err = reviews.DeleteReview(added.Uuid, added.Version)
+		assert.ErrorContains(t, err, "/precondition-failed", "should refuse a stale delete")
+
+		gotten, _ := reviews.GetReview(added.Uuid)
+		assert.Assert(t, is.Equal(gotten.Message, "better"), "should keep the newer change")
+
+		err = reviews.DeleteReview(added.Uuid, gotten.Version)
+		assert.NilError(t, err, "should delete at the current version")
+
+		_, err = reviews.UpdateReview(added.Uuid, Review{Message: "gone", Rating: 1}, gotten.Version)
+		assert.ErrorContains(t, err, "/gone", "should not mistake a deleted review for a stale one")
+	})
 }
 
-func TestGetAllReviews(t *testing.T) {
-	reviews := NewReviews()
-	reviews.AddReview(Review{
-		Message: "good",
-		Rating:  5,
+func TestRevisions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		author := uuid.New().String()
+		moderator := uuid.New().String()
+		added, _ := reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+			UserID:  author,
+		})
+		assert.Assert(t, is.Equal(added.UpdatedBy, author), "should be added by the author")
+		reviews.UpdateReview(added.Uuid, Review{
+			Message:   "good",
+			Rating:    5,
+			UserID:    author,
+			UpdatedBy: moderator,
+		}, ANY_VERSION)
+
+		history, err := reviews.GetRevisions(added.Uuid)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Len(*history, 2), "should have a revision per change")
+		first, second := (*history)[0], (*history)[1]
+		assert.Assert(t, is.Equal(first.Number, 1), "should number revisions from 1")
+		assert.Assert(t, is.Equal(first.Message, "poor"), "should keep the original text")
+		assert.Assert(t, is.Equal(string(first.ChangedBy), author), "should record who added it")
+		assert.Assert(t, is.Equal(second.Message, "good"), "should record the change")
+		assert.Assert(t, is.Equal(string(second.ChangedBy), moderator), "should record who changed it")
+
+		revision, err := reviews.GetRevision(added.Uuid, 1)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.DeepEqual(*revision, first), "should get a single revision")
 	})
-	reviews.AddReview(Review{
-		Message: "average",
-		Rating:  3,
+}
+
+func TestRevisionNotFound(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		added, _ := reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+		})
+		_, err := reviews.GetRevision(added.Uuid, 2)
+		assert.ErrorContains(t, err, "/not-found", "should not find a future revision")
+
+		reviews.DeleteReview(added.Uuid, ANY_VERSION)
+		_, err = reviews.GetRevisions(added.Uuid)
+		assert.ErrorContains(t, err, "/gone", "should hide the history of a trashed review")
+		_, err = reviews.GetRevision(added.Uuid, 1)
+		assert.ErrorContains(t, err, "/gone", "should hide each revision of a trashed review")
+
+		reviews.PurgeDeleted(time.Now().Add(time.Minute))
+		_, err = reviews.GetRevisions(added.Uuid)
+		assert.ErrorContains(t, err, "/not-found", "should drop the history of a purged review")
+	})
+}
+
+func TestDeleteMovesToTrash(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		added, _ := reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+		})
+		assert.NilError(t, reviews.DeleteReview(added.Uuid, ANY_VERSION), "should delete")
+
+		_, err := reviews.GetReview(added.Uuid)
+		assert.ErrorContains(t, err, "/gone", "should be gone")
+		err = reviews.DeleteReview(added.Uuid, ANY_VERSION)
+		assert.ErrorContains(t, err, "/gone", "should not delete twice")
+		filtered, _ := reviews.GetReviewsFiltered(ReviewFilters{})
+		assert.Assert(t, is.Len(*filtered, 0), "should hide trashed reviews from lists")
+
+		trash, err := reviews.GetTrash()
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Len(*trash, 1), "should list the trashed review")
+		assert.Assert(t, (*trash)[0].DeletedAt != nil, "should say when it was deleted")
 	})
-	reviews.AddReview(Review{
-		Message: "poor",
-		Rating:  1,
+}
+
+func TestUndeleteReview(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		added, _ := reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+		})
+		_, err := reviews.UndeleteReview(added.Uuid)
+		assert.ErrorContains(t, err, "/not-found", "should only undelete trashed reviews")
+
+		reviews.DeleteReview(added.Uuid, ANY_VERSION)
+		restored, err := reviews.UndeleteReview(added.Uuid)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, restored.DeletedAt == nil, "should be live again")
+		assert.Assert(t, is.Equal(restored.Message, "poor"), "should keep its content")
+		assert.Assert(t, is.Equal(restored.Version, added.Version+1), "should change its version, and so its ETag")
+
+		updated, err := reviews.UpdateReview(added.Uuid, Review{Message: "better", Rating: 2}, restored.Version)
+		assert.NilError(t, err, "should have no errors")
+		revision, err := reviews.GetRevision(added.Uuid, updated.Version)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(revision.Message, "better"), "should number revisions by version, past the undelete")
+
+		allReviews, _ := reviews.GetReviews()
+		assert.Assert(t, is.Len(*allReviews, 1), "should be listed again")
+		trash, _ := reviews.GetTrash()
+		assert.Assert(t, is.Len(*trash, 0), "should leave the trash")
 	})
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		kept, _ := reviews.AddReview(Review{Message: "good", Rating: 5})
+		old, _ := reviews.AddReview(Review{Message: "poor", Rating: 1})
+		reviews.DeleteReview(old.Uuid, ANY_VERSION)
+		cutoff := time.Now()
+		time.Sleep(time.Millisecond)
+		recent, _ := reviews.AddReview(Review{Message: "average", Rating: 3})
+		reviews.DeleteReview(recent.Uuid, ANY_VERSION)
 
-	allReviews := reviews.GetReviews()
-	assert.Assert(t, is.Len(*allReviews, 3), "should equal the number of reviews added")
+		purged, err := reviews.PurgeDeleted(cutoff)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(purged, 1), "should only purge reviews trashed before the cutoff")
+
+		_, err = reviews.GetReview(old.Uuid)
+		assert.ErrorContains(t, err, "/not-found", "should be gone for good")
+		_, err = reviews.GetReview(recent.Uuid)
+		assert.ErrorContains(t, err, "/gone", "should still be in the trash")
+		_, err = reviews.GetReview(kept.Uuid)
+		assert.NilError(t, err, "should never purge live reviews")
+	})
 }
 
-func TestGetReviewsByMaxRatingBelowOrEquals(t *testing.T) {
-	reviews := NewReviews()
-	reviews.AddReview(Review{
-		Message: "good",
-		Rating:  5,
+func TestDeletedAtIsServerManaged(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		longAgo := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		added, err := reviews.AddReview(Review{Message: "good", Rating: 5, DeletedAt: &longAgo})
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, added.DeletedAt == nil, "should ignore deletedAt when adding")
+
+		updated, err := reviews.UpdateReview(added.Uuid, Review{Message: "better", Rating: 4, DeletedAt: &longAgo}, ANY_VERSION)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, updated.DeletedAt == nil, "should ignore deletedAt when updating")
+
+		_, err = reviews.GetReview(added.Uuid)
+		assert.NilError(t, err, "should still be live")
+		trash, _ := reviews.GetTrash()
+		assert.Assert(t, is.Len(*trash, 0), "should leave the trash empty")
+		purged, _ := reviews.PurgeDeleted(time.Now())
+		assert.Assert(t, is.Equal(purged, 0), "should have nothing to purge")
+		stats, _ := reviews.GetStats(ReviewFilters{})
+		assert.Assert(t, is.Equal(stats.Count, 1), "should count it as live")
 	})
-	reviews.AddReview(Review{
-		Message: "average",
-		Rating:  3,
+}
+
+func TestUpdateReviewInvalidUuid(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		newReview := Review{
+			Message: "good",
+			Rating:  5,
+			Uuid:    uuid.New().String(),
+		}
+		_, err := reviews.UpdateReview(newReview.Uuid, newReview, ANY_VERSION)
+		assert.ErrorContains(t, err, "Refusing to update a non-existing resource", "should return an error")
 	})
-	reviews.AddReview(Review{
-		Message: "poor",
-		Rating:  1,
+}
+
+func TestGetAllReviews(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		reviews.AddReview(Review{
+			Message: "good",
+			Rating:  5,
+		})
+		reviews.AddReview(Review{
+			Message: "average",
+			Rating:  3,
+		})
+		reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+		})
+
+		allReviews, _ := reviews.GetReviews()
+		assert.Assert(t, is.Len(*allReviews, 3), "should equal the number of reviews added")
 	})
+}
 
-	filters := ReviewFilters{
-		MaxRating: 3,
-	}
+func TestGetReviewsByMaxRatingBelowOrEquals(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		reviews.AddReview(Review{
+			Message: "good",
+			Rating:  5,
+		})
+		reviews.AddReview(Review{
+			Message: "average",
+			Rating:  3,
+		})
+		reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+		})
+
+		filters := ReviewFilters{
+			MaxRating: 3,
+		}
 
-	allReviews := reviews.GetReviewsFiltered(filters)
+		allReviews, _ := reviews.GetReviewsFiltered(filters)
 
-	assert.Assert(t, is.Len(*allReviews, 2), "should equal two, for the reviews with ratings 1 and 3")
+		assert.Assert(t, is.Len(*allReviews, 2), "should equal two, for the reviews with ratings 1 and 3")
+	})
 }
 
 func TestGetReviewsByMaxRatingEquals(t *testing.T) {
-	reviews := NewReviews()
-	reviews.AddReview(Review{
-		Message: "good",
-		Rating:  5,
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		reviews.AddReview(Review{
+			Message: "good",
+			Rating:  5,
+		})
+		reviews.AddReview(Review{
+			Message: "average",
+			Rating:  3,
+		})
+		reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+		})
+
+		filters := ReviewFilters{
+			MaxRating: 1,
+		}
+
+		allReviews, _ := reviews.GetReviewsFiltered(filters)
+
+		assert.Assert(t, is.Len(*allReviews, 1), "should equal one, for the review with rating 1")
 	})
-	reviews.AddReview(Review{
-		Message: "average",
-		Rating:  3,
+}
+
+func TestGetReviewsFilteredByAuthorAndRating(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		reviews.AddReview(Review{
+			Message: "good",
+			Rating:  5,
+			UserID:  "f7f680a8-d111-421f-b6b3-493ebf905078",
+		})
+		reviews.AddReview(Review{
+			Message: "average",
+			Rating:  3,
+			UserID:  "f7f680a8-d111-421f-b6b3-493ebf905078",
+		})
+		reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+		})
+
+		no := false
+		filters := ReviewFilters{
+			MinRating: 2,
+			Anonymous: &no,
+		}
+		authored, _ := reviews.GetReviewsFiltered(filters)
+		assert.Assert(t, is.Len(*authored, 2), "should equal two, for the authored reviews rated 2 and up")
+
+		filters = ReviewFilters{
+			UserID:    "f7f680a8-d111-421f-b6b3-493ebf905078",
+			MaxRating: 3,
+		}
+		byUser, _ := reviews.GetReviewsFiltered(filters)
+		assert.Assert(t, is.Len(*byUser, 1), "should equal one, for the user's review rated 3")
 	})
-	reviews.AddReview(Review{
-		Message: "poor",
-		Rating:  1,
+}
+
+func TestGetReviewsByUserFollowsChanges(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		alice := "f7f680a8-d111-421f-b6b3-493ebf905078"
+		bob := "0b6c6b1e-3a3e-4c43-9c3a-1e1f3c1d2e4f"
+		kept, _ := reviews.AddReview(Review{Message: "good", Rating: 5, UserID: alice})
+		moved, _ := reviews.AddReview(Review{Message: "average", Rating: 3, UserID: alice})
+		trashed, _ := reviews.AddReview(Review{Message: "poor", Rating: 1, UserID: alice})
+		reviews.AddReview(Review{Message: "anonymous", Rating: 4})
+
+		reviews.UpdateReview(moved.Uuid, Review{Message: "average", Rating: 3, UserID: bob}, ANY_VERSION)
+		reviews.DeleteReview(trashed.Uuid, ANY_VERSION)
+
+		byAlice, _ := reviews.GetReviewsFiltered(ReviewFilters{UserID: alice})
+		assert.Assert(t, is.Len(*byAlice, 1), "should leave out the review now by bob, and the trashed one")
+		assert.Assert(t, is.Equal((*byAlice)[0].Uuid, kept.Uuid))
+		byBob, _ := reviews.GetReviewsFiltered(ReviewFilters{UserID: bob})
+		assert.Assert(t, is.Len(*byBob, 1), "should find the review now by bob")
+
+		reviews.UndeleteReview(trashed.Uuid)
+		byAlice, _ = reviews.GetReviewsFiltered(ReviewFilters{UserID: alice})
+		assert.Assert(t, is.Len(*byAlice, 2), "should find the restored review again")
 	})
+}
 
-	filters := ReviewFilters{
-		MaxRating: 1,
-	}
+func TestGetReviewsFilteredByCreatedAt(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		first, _ := reviews.AddReview(Review{
+			Message: "good",
+			Rating:  5,
+		})
+		time.Sleep(time.Millisecond)
+		reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+		})
+
+		after, _ := reviews.GetReviewsFiltered(ReviewFilters{CreatedAfter: &first.CreatedAt})
+		assert.Assert(t, is.Len(*after, 1), "should only include reviews created after")
+		assert.Assert(t, is.Equal((*after)[0].Message, "poor"))
+
+		before, _ := reviews.GetReviewsFiltered(ReviewFilters{CreatedBefore: &first.CreatedAt})
+		assert.Assert(t, is.Len(*before, 0), "should only include reviews created before")
+	})
+}
+
+func TestGetReviewsFilteredByStall(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		stall := uuid.New().String()
+		added, _ := reviews.AddReview(Review{
+			Message: "good",
+			Rating:  5,
+			StallID: stall,
+		})
+		reviews.AddReview(Review{
+			Message: "poor",
+			Rating:  1,
+		})
+
+		gotten, _ := reviews.GetReview(added.Uuid)
+		assert.Assert(t, is.Equal(gotten.StallID, stall), "should store the stall")
+
+		atStall, _ := reviews.GetReviewsFiltered(ReviewFilters{StallID: stall})
+		assert.Assert(t, is.Len(*atStall, 1), "should only include the stall's reviews")
+		assert.Assert(t, is.Equal((*atStall)[0].Message, "good"))
+	})
+}
+
+func TestGetStats(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		author := uuid.New().String()
+		stall := uuid.New().String()
+		reviews.AddReview(Review{Message: "good", Rating: 5, UserID: author, StallID: stall})
+		changed, _ := reviews.AddReview(Review{Message: "poor", Rating: 1, StallID: stall})
+		trashed, _ := reviews.AddReview(Review{Message: "average", Rating: 3})
+		restored, _ := reviews.AddReview(Review{Message: "fine", Rating: 4, UserID: author})
+
+		reviews.UpdateReview(changed.Uuid, Review{Message: "better", Rating: 2, StallID: stall}, ANY_VERSION)
+		reviews.DeleteReview(trashed.Uuid, ANY_VERSION)
+		reviews.DeleteReview(restored.Uuid, ANY_VERSION)
+		reviews.UndeleteReview(restored.Uuid)
+
+		all, err := reviews.GetStats(ReviewFilters{})
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(all.Count, 3), "should only count live reviews")
+		assert.Assert(t, is.DeepEqual(all.Histogram, Histogram{0, 1, 0, 1, 1}), "should follow updates")
+		assert.Assert(t, is.Equal(*all.Mean, 11.0/3), "should average the ratings")
+		assert.Assert(t, is.Equal(*all.Median, 4.0), "should find the middle rating")
 
-	allReviews := reviews.GetReviewsFiltered(filters)
+		byStall, _ := reviews.GetStats(ReviewFilters{StallID: stall})
+		assert.Assert(t, is.Equal(byStall.Count, 2), "should filter by stall")
+		byAuthor, _ := reviews.GetStats(ReviewFilters{UserID: author, MinRating: 5})
+		assert.Assert(t, is.Equal(byAuthor.Count, 1), "should filter by author and rating")
+		yes := true
+		anonymous, _ := reviews.GetStats(ReviewFilters{Anonymous: &yes})
+		assert.Assert(t, is.Equal(anonymous.Count, 1), "should filter anonymous reviews")
 
-	assert.Assert(t, is.Len(*allReviews, 1), "should equal one, for the review with rating 1")
+		future := time.Now().Add(time.Hour)
+		before, _ := reviews.GetStats(ReviewFilters{CreatedBefore: &future, StallID: stall})
+		assert.Assert(t, is.DeepEqual(before.Histogram, byStall.Histogram), "should agree when filtering by date")
+
+		reviews.Clear()
+		cleared, _ := reviews.GetStats(ReviewFilters{})
+		assert.Assert(t, is.Equal(cleared.Count, 0), "should reset with the store")
+	})
 }
 
 func TestAnonymousReviewHasNullForUserID(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		review, _ := reviews.AddReview(Review{
+			Message: "good",
+			Rating:  5,
+		})
 
-	reviews := NewReviews()
-	review, _ := reviews.AddReview(Review{
-		Message: "good",
-		Rating:  5,
+		jsonBytes, _ := json.Marshal(review)
+
+		assert.Assert(t, is.Contains(string(jsonBytes), `"userId":null`), "should equal null when serialized in JSON")
 	})
+}
 
-	jsonBytes, _ := json.Marshal(review)
+func TestClearReviews(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		reviews.AddReview(Review{
+			Message: "good",
+			Rating:  5,
+		})
+
+		err := reviews.Clear()
+		assert.NilError(t, err, "should have no errors")
+		allReviews, _ := reviews.GetReviews()
+		assert.Assert(t, is.Len(*allReviews, 0), "should have no reviews")
+	})
+}
 
-	assert.Assert(t, is.Contains(string(jsonBytes), `"userId":null`), "should equal null when serialized in JSON")
+// Run with -race to catch unsynchronised access
+func TestConcurrentAddUpdateDeleteList(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		const workers = 50
+		var wg sync.WaitGroup
+
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				added, err := reviews.AddReview(Review{
+					Message: "poor",
+					Rating:  1,
+				})
+				assert.Check(t, err, "should add")
+				if err != nil {
+					return
+				}
+
+				_, err = reviews.UpdateReview(added.Uuid, Review{
+					Message: "good",
+					Rating:  5,
+				}, ANY_VERSION)
+				assert.Check(t, err, "should update")
+
+				reviews.GetReviews()
+				reviews.GetReviewsFiltered(ReviewFilters{MaxRating: 3})
+				reviews.GetReview(added.Uuid)
+
+				// Keep every other review
+				if i%2 == 0 {
+					assert.Check(t, reviews.DeleteReview(added.Uuid, ANY_VERSION), "should delete")
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		allReviews, err := reviews.GetReviews()
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Len(*allReviews, workers/2), "should keep every review that wasn't deleted")
+		for _, review := range *allReviews {
+			assert.Assert(t, is.Equal(review.Rating, 5), "should have applied every update")
+		}
+	})
 }
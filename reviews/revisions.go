@@ -0,0 +1,34 @@
+package reviews
+
+import (
+	"farmstall/problems"
+	"farmstall/utils"
+	"fmt"
+	"time"
+)
+
+// Revision is a review as it was at one version. Revisions are only ever
+// appended, restoring an old one adds a new revision with its contents.
+type Revision struct {
+	Number    int              `json:"revision"`
+	Message   string           `json:"message"`
+	Rating    int              `json:"rating"`
+	ChangedBy utils.NullString `json:"changedBy"`
+	ChangedAt time.Time        `json:"changedAt"`
+}
+
+func revisionOf(r Review) Revision {
+	return Revision{
+		Number:    r.Version,
+		Message:   r.Message,
+		Rating:    r.Rating,
+		ChangedBy: utils.NullString(r.UpdatedBy),
+		ChangedAt: r.UpdatedAt,
+	}
+}
+
+func revisionNotFound(id string, number int) error {
+	return problems.NotFound(problems.ProblemJson{
+		Instance: fmt.Sprintf("%s/%s/revisions/%d", BASE_PATH, id, number),
+	})
+}
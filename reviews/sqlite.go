@@ -0,0 +1,695 @@
+package reviews
+
+import (
+	"database/sql"
+	"farmstall/database"
+	"farmstall/problems"
+	"farmstall/utils"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// SQLReviews is a ReviewStore backed by a database opened with farmstall/database
+type SQLReviews struct {
+	db *sql.DB
+}
+
+func NewSQLReviews(db *sql.DB) *SQLReviews {
+	return &SQLReviews{db: db}
+}
+
+var _ ReviewStore = (*SQLReviews)(nil)
+
+func nullable(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+const COLUMNS = `uuid, message, rating, user_id, created_at, updated_at, updated_by, version, deleted_at, stall_id, helpful, unhelpful, status`
+
+const REVISION_COLUMNS = `revision, message, rating, changed_by, changed_at`
+
+// Snapshots the current state of a review into its history
+const RECORD_REVISION = `INSERT INTO review_revisions (review_id, ` + REVISION_COLUMNS + `)
+	SELECT uuid, version, message, rating, updated_by, updated_at FROM reviews WHERE uuid = ?`
+
+func (rs *SQLReviews) UpdateReview(reviewId string, r Review, ifVersion int) (*Review, error) {
+	if err := checkMessage(r.Message); err != nil {
+		return nil, err
+	}
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE reviews SET message = ?, rating = ?, user_id = ?, stall_id = ?, updated_at = ?, updated_by = ?, version = version + 1
+		WHERE uuid = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)`,
+		r.Message, r.Rating, nullable(r.UserID), nullable(r.StallID), utils.Now().UnixNano(), nullable(r.UpdatedBy), reviewId, ifVersion, ifVersion)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, unchanged(tx, reviewId, problems.UpdateNonExisting(problems.ProblemJson{
+			Instance: BASE_PATH + "/" + reviewId,
+		}))
+	}
+	if _, err := tx.Exec(RECORD_REVISION, reviewId); err != nil {
+		return nil, database.Error(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, database.Error(err)
+	}
+
+	return rs.GetReview(reviewId)
+}
+
+func (rs *SQLReviews) AddReview(r Review) (*Review, error) {
+	if err := checkMessage(r.Message); err != nil {
+		return nil, err
+	}
+	r.Uuid = uuid.New().String()
+	r.CreatedAt = utils.Now()
+	r.UpdatedAt = r.CreatedAt
+	r.UpdatedBy = r.UserID
+	r.Version = 1
+	r.Helpful, r.Unhelpful = 0, 0
+	r.DeletedAt = nil
+	if r.Status == "" {
+		r.Status = PUBLISHED
+	}
+
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO reviews (`+COLUMNS+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULL, ?, 0, 0, ?)`,
+		r.Uuid, r.Message, r.Rating, nullable(r.UserID), r.CreatedAt.UnixNano(), r.UpdatedAt.UnixNano(), nullable(r.UpdatedBy), r.Version, nullable(r.StallID), r.Status)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if _, err := tx.Exec(RECORD_REVISION, r.Uuid); err != nil {
+		return nil, database.Error(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, database.Error(err)
+	}
+	return &r, nil
+}
+
+func (rs *SQLReviews) GetReview(id string) (*Review, error) {
+	row := rs.db.QueryRow(`SELECT `+COLUMNS+` FROM reviews WHERE uuid = ?`, id)
+	review, err := scanReview(row)
+	if err == sql.ErrNoRows {
+		return nil, problems.NotFound(problems.ProblemJson{
+			Instance: BASE_PATH + "/" + id,
+		})
+	}
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if review.DeletedAt != nil {
+		return nil, gone(id, review.DeletedAt)
+	}
+	return review, nil
+}
+
+// Explains why a conditional UPDATE touched no rows
+func unchanged(tx *sql.Tx, id string, notFound error) error {
+	existing, err := scanReview(tx.QueryRow(`SELECT `+COLUMNS+` FROM reviews WHERE uuid = ?`, id))
+	if err == sql.ErrNoRows {
+		return notFound
+	}
+	if err != nil {
+		return database.Error(err)
+	}
+	if existing.DeletedAt != nil {
+		return gone(id, existing.DeletedAt)
+	}
+	return versionMismatch(id, existing.Version)
+}
+
+func (rs *SQLReviews) DeleteReview(id string, ifVersion int) error {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return database.Error(err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE reviews SET deleted_at = ? WHERE uuid = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)`,
+		utils.Now().UnixNano(), id, ifVersion, ifVersion)
+	if err != nil {
+		return database.Error(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return unchanged(tx, id, problems.NotFound(problems.ProblemJson{
+			Instance: BASE_PATH + "/" + id,
+		}))
+	}
+	if err := tx.Commit(); err != nil {
+		return database.Error(err)
+	}
+	return nil
+}
+
+func (rs *SQLReviews) GetTrash() (*[]Review, error) {
+	return rs.query(`SELECT ` + COLUMNS + ` FROM reviews WHERE deleted_at IS NOT NULL ORDER BY deleted_at, uuid`)
+}
+
+func (rs *SQLReviews) UndeleteReview(id string) (*Review, error) {
+	res, err := rs.db.Exec(`UPDATE reviews SET deleted_at = NULL, version = version + 1 WHERE uuid = ? AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, notInTrash(id)
+	}
+	return rs.GetReview(id)
+}
+
+func (rs *SQLReviews) PurgeDeleted(cutoff time.Time) (int, error) {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return 0, database.Error(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM review_revisions WHERE review_id IN
+		(SELECT uuid FROM reviews WHERE deleted_at IS NOT NULL AND deleted_at < ?)`, cutoff.UnixNano())
+	if err != nil {
+		return 0, database.Error(err)
+	}
+	res, err := tx.Exec(`DELETE FROM reviews WHERE deleted_at IS NOT NULL AND deleted_at < ?`, cutoff.UnixNano())
+	if err != nil {
+		return 0, database.Error(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, database.Error(err)
+	}
+	purged, _ := res.RowsAffected()
+	return int(purged), nil
+}
+
+func (rs *SQLReviews) GetRevisions(id string) (*[]Revision, error) {
+	if _, err := rs.GetReview(id); err != nil {
+		return nil, err
+	}
+	rows, err := rs.db.Query(`SELECT `+REVISION_COLUMNS+` FROM review_revisions WHERE review_id = ? ORDER BY revision`, id)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer rows.Close()
+
+	v := []Revision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, database.Error(err)
+		}
+		v = append(v, *revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.Error(err)
+	}
+	if len(v) == 0 {
+		return nil, problems.NotFound(problems.ProblemJson{
+			Instance: BASE_PATH + "/" + id,
+		})
+	}
+	return &v, nil
+}
+
+func (rs *SQLReviews) GetRevision(id string, number int) (*Revision, error) {
+	if _, err := rs.GetReview(id); err != nil {
+		return nil, err
+	}
+	row := rs.db.QueryRow(`SELECT `+REVISION_COLUMNS+` FROM review_revisions WHERE review_id = ? AND revision = ?`, id, number)
+	revision, err := scanRevision(row)
+	if err == sql.ErrNoRows {
+		return nil, revisionNotFound(id, number)
+	}
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	return revision, nil
+}
+
+const REPLY_COLUMNS = `uuid, review_id, message, user_id, created_at, updated_at`
+
+// The review a reply belongs to must be live
+func liveReview(tx *sql.Tx, id string) error {
+	review, err := scanReview(tx.QueryRow(`SELECT `+COLUMNS+` FROM reviews WHERE uuid = ?`, id))
+	if err == sql.ErrNoRows {
+		return problems.NotFound(problems.ProblemJson{
+			Instance: BASE_PATH + "/" + id,
+		})
+	}
+	if err != nil {
+		return database.Error(err)
+	}
+	if review.DeletedAt != nil {
+		return gone(id, review.DeletedAt)
+	}
+	return nil
+}
+
+func (rs *SQLReviews) AddReply(reviewId string, reply Reply) (*Reply, error) {
+	if err := checkMessage(reply.Message); err != nil {
+		return nil, err
+	}
+	reply.Uuid = uuid.New().String()
+	reply.ReviewID = reviewId
+	reply.CreatedAt = utils.Now()
+	reply.UpdatedAt = reply.CreatedAt
+
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer tx.Rollback()
+
+	if err := liveReview(tx, reviewId); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`INSERT INTO review_replies (`+REPLY_COLUMNS+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		reply.Uuid, reply.ReviewID, reply.Message, reply.UserID, reply.CreatedAt.UnixNano(), reply.UpdatedAt.UnixNano())
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, database.Error(err)
+	}
+	return &reply, nil
+}
+
+func (rs *SQLReviews) GetReplies(reviewId string) (*[]Reply, error) {
+	if _, err := rs.GetReview(reviewId); err != nil {
+		return nil, err
+	}
+	rows, err := rs.db.Query(`SELECT `+REPLY_COLUMNS+` FROM review_replies WHERE review_id = ? ORDER BY created_at, rowid`, reviewId)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer rows.Close()
+
+	v := []Reply{}
+	for rows.Next() {
+		reply, err := scanReply(rows)
+		if err != nil {
+			return nil, database.Error(err)
+		}
+		v = append(v, *reply)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.Error(err)
+	}
+	return &v, nil
+}
+
+func (rs *SQLReviews) GetReply(reviewId, replyId string) (*Reply, error) {
+	if _, err := rs.GetReview(reviewId); err != nil {
+		return nil, err
+	}
+	row := rs.db.QueryRow(`SELECT `+REPLY_COLUMNS+` FROM review_replies WHERE review_id = ? AND uuid = ?`, reviewId, replyId)
+	reply, err := scanReply(row)
+	if err == sql.ErrNoRows {
+		return nil, replyNotFound(reviewId, replyId)
+	}
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	return reply, nil
+}
+
+func (rs *SQLReviews) UpdateReply(reviewId, replyId string, reply Reply) (*Reply, error) {
+	if err := checkMessage(reply.Message); err != nil {
+		return nil, err
+	}
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer tx.Rollback()
+
+	if err := liveReview(tx, reviewId); err != nil {
+		return nil, err
+	}
+	res, err := tx.Exec(`UPDATE review_replies SET message = ?, updated_at = ? WHERE review_id = ? AND uuid = ?`,
+		reply.Message, utils.Now().UnixNano(), reviewId, replyId)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, replyNotFound(reviewId, replyId)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, database.Error(err)
+	}
+	return rs.GetReply(reviewId, replyId)
+}
+
+func (rs *SQLReviews) DeleteReply(reviewId, replyId string) error {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return database.Error(err)
+	}
+	defer tx.Rollback()
+
+	if err := liveReview(tx, reviewId); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM review_replies WHERE review_id = ? AND uuid = ?`, reviewId, replyId)
+	if err != nil {
+		return database.Error(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return replyNotFound(reviewId, replyId)
+	}
+	if err := tx.Commit(); err != nil {
+		return database.Error(err)
+	}
+	return nil
+}
+
+// Works the counts on a review out again from its votes
+const COUNT_VOTES = `UPDATE reviews SET
+	helpful = (SELECT COUNT(*) FROM review_votes WHERE review_id = reviews.uuid AND helpful = 1),
+	unhelpful = (SELECT COUNT(*) FROM review_votes WHERE review_id = reviews.uuid AND helpful = 0)
+	WHERE uuid = ?`
+
+func (rs *SQLReviews) Vote(reviewId, voter string, helpful bool) (*Review, error) {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer tx.Rollback()
+
+	if err := liveReview(tx, reviewId); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`INSERT INTO review_votes (review_id, voter, helpful) VALUES (?, ?, ?)
+		ON CONFLICT (review_id, voter) DO UPDATE SET helpful = excluded.helpful`, reviewId, voter, helpful)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if _, err := tx.Exec(COUNT_VOTES, reviewId); err != nil {
+		return nil, database.Error(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, database.Error(err)
+	}
+	return rs.GetReview(reviewId)
+}
+
+func (rs *SQLReviews) Unvote(reviewId, voter string) (*Review, error) {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer tx.Rollback()
+
+	if err := liveReview(tx, reviewId); err != nil {
+		return nil, err
+	}
+	res, err := tx.Exec(`DELETE FROM review_votes WHERE review_id = ? AND voter = ?`, reviewId, voter)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, voteNotFound(reviewId)
+	}
+	if _, err := tx.Exec(COUNT_VOTES, reviewId); err != nil {
+		return nil, database.Error(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, database.Error(err)
+	}
+	return rs.GetReview(reviewId)
+}
+
+const FLAG_COLUMNS = `uuid, review_id, reason, reporter, created_at`
+
+func (rs *SQLReviews) AddFlag(reviewId string, flag Flag) (*Flag, error) {
+	flag.Uuid = uuid.New().String()
+	flag.ReviewID = reviewId
+	flag.CreatedAt = utils.Now()
+
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer tx.Rollback()
+
+	if err := liveReview(tx, reviewId); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`INSERT OR REPLACE INTO review_flags (`+FLAG_COLUMNS+`) VALUES (?, ?, ?, ?, ?)`,
+		flag.Uuid, flag.ReviewID, flag.Reason, flag.Reporter, flag.CreatedAt.UnixNano())
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, database.Error(err)
+	}
+	return &flag, nil
+}
+
+func (rs *SQLReviews) GetQueue() (*[]QueueItem, error) {
+	queued, err := rs.query(`SELECT ` + COLUMNS + ` FROM reviews WHERE deleted_at IS NULL
+		AND (status = 'pending' OR uuid IN (SELECT review_id FROM review_flags))
+		ORDER BY created_at, uuid`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := rs.db.Query(`SELECT ` + FLAG_COLUMNS + ` FROM review_flags ORDER BY created_at, rowid`)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer rows.Close()
+	flags := map[string][]Flag{}
+	for rows.Next() {
+		var f Flag
+		var createdAt int64
+		if err := rows.Scan(&f.Uuid, &f.ReviewID, &f.Reason, &f.Reporter, &createdAt); err != nil {
+			return nil, database.Error(err)
+		}
+		f.CreatedAt = time.Unix(0, createdAt).UTC()
+		flags[f.ReviewID] = append(flags[f.ReviewID], f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.Error(err)
+	}
+
+	v := make([]QueueItem, 0, len(*queued))
+	for _, review := range *queued {
+		item := QueueItem{Review: review, Flags: flags[review.Uuid]}
+		if item.Flags == nil {
+			item.Flags = []Flag{}
+		}
+		v = append(v, item)
+	}
+	return &v, nil
+}
+
+func (rs *SQLReviews) Moderate(reviewId string, status string) (*Review, error) {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer tx.Rollback()
+
+	if err := liveReview(tx, reviewId); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE reviews SET status = ? WHERE uuid = ?`, status, reviewId); err != nil {
+		return nil, database.Error(err)
+	}
+	if _, err := tx.Exec(`DELETE FROM review_flags WHERE review_id = ?`, reviewId); err != nil {
+		return nil, database.Error(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, database.Error(err)
+	}
+	return rs.GetReview(reviewId)
+}
+
+func (rs *SQLReviews) GetReviews() (*[]Review, error) {
+	return rs.query(`SELECT ` + COLUMNS + ` FROM reviews WHERE deleted_at IS NULL AND status = 'published' ORDER BY uuid`)
+}
+
+func (rs *SQLReviews) GetReviewsFiltered(filters ReviewFilters) (*[]Review, error) {
+	where, args := filterClause(filters)
+	return rs.query(`SELECT `+COLUMNS+` FROM reviews WHERE `+where+` ORDER BY uuid`, args...)
+}
+
+// The SQL equivalent of ReviewFilters.Match
+func filterClause(f ReviewFilters) (string, []interface{}) {
+	clauses := []string{"deleted_at IS NULL", "status = 'published'"}
+	args := []interface{}{}
+	if f.MaxRating != 0 {
+		clauses = append(clauses, "rating <= ?")
+		args = append(args, f.MaxRating)
+	}
+	if f.MinRating != 0 {
+		clauses = append(clauses, "rating >= ?")
+		args = append(args, f.MinRating)
+	}
+	if f.UserID != "" {
+		clauses = append(clauses, "user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.StallID != "" {
+		clauses = append(clauses, "stall_id = ?")
+		args = append(args, f.StallID)
+	}
+	if f.Anonymous != nil {
+		if *f.Anonymous {
+			clauses = append(clauses, "user_id IS NULL")
+		} else {
+			clauses = append(clauses, "user_id IS NOT NULL")
+		}
+	}
+	if f.CreatedBefore != nil {
+		clauses = append(clauses, "created_at < ?")
+		args = append(args, f.CreatedBefore.UnixNano())
+	}
+	if f.CreatedAfter != nil {
+		clauses = append(clauses, "created_at > ?")
+		args = append(args, f.CreatedAfter.UnixNano())
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+func (rs *SQLReviews) GetStats(filters ReviewFilters) (*Stats, error) {
+	var rows *sql.Rows
+	var err error
+	if filters.bySegment() {
+		where, args := statsClause(filters)
+		rows, err = rs.db.Query(`SELECT rating, SUM(count) FROM review_stats WHERE `+where+` GROUP BY rating`, args...)
+	} else {
+		where, args := filterClause(filters)
+		rows, err = rs.db.Query(`SELECT rating, COUNT(*) FROM reviews WHERE `+where+` GROUP BY rating`, args...)
+	}
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer rows.Close()
+
+	var h Histogram
+	for rows.Next() {
+		var rating, count int
+		if err := rows.Scan(&rating, &count); err != nil {
+			return nil, database.Error(err)
+		}
+		h.tally(rating, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.Error(err)
+	}
+	stats := h.Stats()
+	return &stats, nil
+}
+
+// The equivalent of filterClause for the review_stats table
+func statsClause(f ReviewFilters) (string, []interface{}) {
+	clauses := []string{"count > 0"}
+	args := []interface{}{}
+	if f.MaxRating != 0 {
+		clauses = append(clauses, "rating <= ?")
+		args = append(args, f.MaxRating)
+	}
+	if f.MinRating != 0 {
+		clauses = append(clauses, "rating >= ?")
+		args = append(args, f.MinRating)
+	}
+	if f.UserID != "" {
+		clauses = append(clauses, "user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.StallID != "" {
+		clauses = append(clauses, "stall_id = ?")
+		args = append(args, f.StallID)
+	}
+	if f.Anonymous != nil {
+		if *f.Anonymous {
+			clauses = append(clauses, "user_id = ''")
+		} else {
+			clauses = append(clauses, "user_id != ''")
+		}
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+func (rs *SQLReviews) Clear() error {
+	if _, err := rs.db.Exec(`DELETE FROM review_flags; DELETE FROM review_votes; DELETE FROM review_replies; DELETE FROM reviews; DELETE FROM review_revisions`); err != nil {
+		return database.Error(err)
+	}
+	return nil
+}
+
+func (rs *SQLReviews) query(query string, args ...interface{}) (*[]Review, error) {
+	rows, err := rs.db.Query(query, args...)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer rows.Close()
+
+	v := []Review{}
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, database.Error(err)
+		}
+		v = append(v, *review)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.Error(err)
+	}
+	return &v, nil
+}
+
+func scanReview(row database.Scanner) (*Review, error) {
+	var r Review
+	var userID, updatedBy, stallID sql.NullString
+	var createdAt, updatedAt int64
+	var deletedAt sql.NullInt64
+	if err := row.Scan(&r.Uuid, &r.Message, &r.Rating, &userID, &createdAt, &updatedAt, &updatedBy, &r.Version, &deletedAt, &stallID, &r.Helpful, &r.Unhelpful, &r.Status); err != nil {
+		return nil, err
+	}
+	if deletedAt.Valid {
+		t := time.Unix(0, deletedAt.Int64).UTC()
+		r.DeletedAt = &t
+	}
+	r.UserID = userID.String
+	r.UpdatedBy = updatedBy.String
+	r.StallID = stallID.String
+	r.CreatedAt = time.Unix(0, createdAt).UTC()
+	r.UpdatedAt = time.Unix(0, updatedAt).UTC()
+	return &r, nil
+}
+
+func scanReply(row database.Scanner) (*Reply, error) {
+	var r Reply
+	var createdAt, updatedAt int64
+	if err := row.Scan(&r.Uuid, &r.ReviewID, &r.Message, &r.UserID, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	r.CreatedAt = time.Unix(0, createdAt).UTC()
+	r.UpdatedAt = time.Unix(0, updatedAt).UTC()
+	return &r, nil
+}
+
+func scanRevision(row database.Scanner) (*Revision, error) {
+	var r Revision
+	var changedBy sql.NullString
+	var changedAt int64
+	if err := row.Scan(&r.Number, &r.Message, &r.Rating, &changedBy, &changedAt); err != nil {
+		return nil, err
+	}
+	r.ChangedBy = utils.NullString(changedBy.String)
+	r.ChangedAt = time.Unix(0, changedAt).UTC()
+	return &r, nil
+}
@@ -0,0 +1,101 @@
+package reviews
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Histogram counts reviews by rating, index 0 holds the 1 star reviews
+type Histogram [5]int
+
+// Stats summarises the ratings of a set of reviews
+type Stats struct {
+	Count int `json:"count"`
+	// Null when there are no reviews
+	Mean      *float64  `json:"mean"`
+	Median    *float64  `json:"median"`
+	Histogram Histogram `json:"histogram"`
+}
+
+// Reviews are tallied per author and stall, so the stats of any
+// combination of the userId, stallId and anonymous filters can be summed
+// from these without looking at individual reviews
+type segment struct {
+	UserID  string
+	StallID string
+}
+
+func segmentOf(r Review) segment {
+	return segment{UserID: r.UserID, StallID: r.StallID}
+}
+
+// Ratings are left to Histogram.add
+func (f ReviewFilters) matchSegment(s segment) bool {
+	f.MinRating, f.MaxRating = 0, 0
+	return f.Match(Review{UserID: s.UserID, StallID: s.StallID})
+}
+
+// Whether the filters can be answered from the tallies alone. Date ranges
+// can't, those stats are worked out from the matching reviews instead.
+func (f ReviewFilters) bySegment() bool {
+	return f.CreatedBefore == nil && f.CreatedAfter == nil
+}
+
+// Counts the buckets of other, within the rating range of f
+func (h *Histogram) add(other Histogram, f ReviewFilters) {
+	for i, n := range other {
+		rating := i + 1
+		if (f.MinRating != 0 && rating < f.MinRating) || (f.MaxRating != 0 && rating > f.MaxRating) {
+			continue
+		}
+		h[i] += n
+	}
+}
+
+// Stats works out the count, mean and median from the histogram
+func (h Histogram) Stats() Stats {
+	stats := Stats{Histogram: h}
+	sum := 0
+	for i, n := range h {
+		stats.Count += n
+		sum += (i + 1) * n
+	}
+	if stats.Count == 0 {
+		return stats
+	}
+
+	mean := float64(sum) / float64(stats.Count)
+	lower, upper := h.nth((stats.Count-1)/2), h.nth(stats.Count/2)
+	median := float64(lower+upper) / 2
+	stats.Mean = &mean
+	stats.Median = &median
+	return stats
+}
+
+// The rating of the nth review, counting from zero, when sorted by rating
+func (h Histogram) nth(n int) int {
+	for i, count := range h {
+		if n < count {
+			return i + 1
+		}
+		n -= count
+	}
+	return 0
+}
+
+// Counts one review, or takes it away again when delta is -1
+func (h *Histogram) tally(rating int, delta int) {
+	if rating < 1 || rating > len(h) {
+		return
+	}
+	h[rating-1] += delta
+}
+
+// Ratings are the keys, eg: {"1": 0, "2": 3, "3": 1, "4": 7, "5": 12}
+func (h Histogram) MarshalJSON() ([]byte, error) {
+	buckets := map[string]int{}
+	for i, n := range h {
+		buckets[strconv.Itoa(i+1)] = n
+	}
+	return json.Marshal(buckets)
+}
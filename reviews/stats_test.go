@@ -0,0 +1,31 @@
+package reviews
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestHistogramStats(t *testing.T) {
+	stats := Histogram{1, 0, 2, 0, 1}.Stats()
+	assert.Assert(t, is.Equal(stats.Count, 4), "should count every review")
+	assert.Assert(t, is.Equal(*stats.Mean, 3.0), "should average the ratings")
+	assert.Assert(t, is.Equal(*stats.Median, 3.0), "should find the middle rating")
+
+	stats = Histogram{0, 0, 1, 1, 0}.Stats()
+	assert.Assert(t, is.Equal(*stats.Median, 3.5), "should average the middle two of an even count")
+}
+
+func TestHistogramStatsEmpty(t *testing.T) {
+	stats := Histogram{}.Stats()
+	assert.Assert(t, is.Equal(stats.Count, 0))
+	assert.Assert(t, stats.Mean == nil, "should have no mean")
+	assert.Assert(t, stats.Median == nil, "should have no median")
+}
+
+func TestHistogramJSON(t *testing.T) {
+	data, _ := json.Marshal(Histogram{1, 0, 2, 0, 3})
+	assert.Equal(t, string(data), `{"1":1,"2":0,"3":2,"4":0,"5":3}`)
+}
@@ -0,0 +1,63 @@
+package reviews
+
+import "time"
+
+// ReviewStore is implemented by every backend that can hold reviews.
+// The HTTP handlers only ever talk to this interface, so backends can be
+// swapped without touching them.
+type ReviewStore interface {
+	AddReview(r Review) (*Review, error)
+	GetReview(id string) (*Review, error)
+	// UpdateReview and DeleteReview fail with a PreconditionFailed problem
+	// unless the stored review is at ifVersion, or ifVersion is ANY_VERSION.
+	// The check and the change happen atomically.
+	UpdateReview(reviewId string, r Review, ifVersion int) (*Review, error)
+	DeleteReview(id string, ifVersion int) error
+	// GetReviews, GetReviewsFiltered and GetStats only see published
+	// reviews, GetReview sees them all
+	GetReviews() (*[]Review, error)
+	GetReviewsFiltered(filters ReviewFilters) (*[]Review, error)
+	// Every add and update records a revision, oldest first. Revisions are
+	// numbered by the version they made, which undeleting also bumps
+	GetRevisions(id string) (*[]Revision, error)
+	GetRevision(id string, number int) (*Revision, error)
+	// DeleteReview only moves a review to the trash. Trashed reviews are
+	// Gone to every other method, until they are undeleted or purged.
+	GetTrash() (*[]Review, error)
+	UndeleteReview(id string) (*Review, error)
+	// PurgeDeleted removes reviews trashed before cutoff for good, along
+	// with their revisions, replies, votes and flags, and returns how many there were
+	PurgeDeleted(cutoff time.Time) (int, error)
+	// Replies to a review, which are Gone along with it while it is in the
+	// trash. GetReplies lists them oldest first.
+	AddReply(reviewId string, reply Reply) (*Reply, error)
+	GetReplies(reviewId string) (*[]Reply, error)
+	GetReply(reviewId, replyId string) (*Reply, error)
+	// Only the message of a reply can change
+	UpdateReply(reviewId, replyId string, reply Reply) (*Reply, error)
+	DeleteReply(reviewId, replyId string) error
+	// Vote records whether voter found a review helpful, replacing any vote
+	// they made before, and returns the review with its new counts. Votes
+	// don't change a review's version.
+	Vote(reviewId, voter string, helpful bool) (*Review, error)
+	// Unvote takes voter's vote back, it is NotFound if there isn't one
+	Unvote(reviewId, voter string) (*Review, error)
+	// AddFlag reports a review to the moderators, replacing any earlier
+	// report by the same reporter
+	AddFlag(reviewId string, flag Flag) (*Flag, error)
+	// GetQueue lists the live reviews that are pending or flagged
+	GetQueue() (*[]QueueItem, error)
+	// Moderate sets the status of a review and resolves its flags. It
+	// doesn't change the review's version.
+	Moderate(reviewId string, status string) (*Review, error)
+	// GetStats summarises the ratings of the live reviews that match filters
+	GetStats(filters ReviewFilters) (*Stats, error)
+	// Clear removes every review
+	Clear() error
+}
+
+// ANY_VERSION skips the version check in UpdateReview and DeleteReview
+const ANY_VERSION = 0
+
+// Make sure the in-memory store keeps up with the interface
+var _ ReviewStore = (*Reviews)(nil)
@@ -0,0 +1,67 @@
+package reviews
+
+import "farmstall/problems"
+
+// Vote is what clients send to say whether a review helped them
+type Vote struct {
+	Helpful bool `json:"helpful"`
+}
+
+func voteNotFound(reviewId string) error {
+	return problems.NotFound(problems.ProblemJson{
+		Instance: BASE_PATH + "/" + reviewId + "/vote",
+		Detail:   "There is no vote to take back",
+	})
+}
+
+// Counts a vote on the stored review, or takes it away again when delta is -1.
+// Callers must hold rs.mu
+func (rs *Reviews) countVote(reviewId string, helpful bool, delta int) {
+	review := rs.Reviews[reviewId]
+	if helpful {
+		review.Helpful += delta
+	} else {
+		review.Unhelpful += delta
+	}
+	rs.Reviews[reviewId] = review
+}
+
+func (rs *Reviews) Vote(reviewId, voter string, helpful bool) (*Review, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if err := rs.liveReview(reviewId); err != nil {
+		return nil, err
+	}
+	votes, ok := rs.Votes[reviewId]
+	if !ok {
+		votes = map[string]bool{}
+		rs.Votes[reviewId] = votes
+	}
+	if previous, voted := votes[voter]; voted {
+		rs.countVote(reviewId, previous, -1)
+	}
+	votes[voter] = helpful
+	rs.countVote(reviewId, helpful, 1)
+
+	review := rs.Reviews[reviewId]
+	return &review, nil
+}
+
+func (rs *Reviews) Unvote(reviewId, voter string) (*Review, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if err := rs.liveReview(reviewId); err != nil {
+		return nil, err
+	}
+	previous, voted := rs.Votes[reviewId][voter]
+	if !voted {
+		return nil, voteNotFound(reviewId)
+	}
+	delete(rs.Votes[reviewId], voter)
+	rs.countVote(reviewId, previous, -1)
+
+	review := rs.Reviews[reviewId]
+	return &review, nil
+}
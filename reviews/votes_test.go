@@ -0,0 +1,82 @@
+package reviews
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestVote(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		added, _ := reviews.AddReview(Review{Message: "Go early for the bread", Rating: 5})
+
+		voted, err := reviews.Vote(added.Uuid, "user:alice", true)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(voted.Helpful, 1))
+		reviews.Vote(added.Uuid, "anon:1234", true)
+		voted, _ = reviews.Vote(added.Uuid, "user:bob", false)
+		assert.Assert(t, is.Equal(voted.Helpful, 2), "should count every voter")
+		assert.Assert(t, is.Equal(voted.Unhelpful, 1))
+		assert.Assert(t, is.Equal(voted.Version, 1), "should not change the version")
+
+		voted, _ = reviews.Vote(added.Uuid, "user:alice", true)
+		assert.Assert(t, is.Equal(voted.Helpful, 2), "should only count one vote per voter")
+		voted, _ = reviews.Vote(added.Uuid, "user:alice", false)
+		assert.Assert(t, is.Equal(voted.Helpful, 1), "should change the vote")
+		assert.Assert(t, is.Equal(voted.Unhelpful, 2))
+
+		gotten, _ := reviews.GetReview(added.Uuid)
+		assert.Assert(t, is.DeepEqual(gotten, voted), "should keep the counts")
+	})
+}
+
+func TestUnvote(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		added, _ := reviews.AddReview(Review{Message: "good", Rating: 4})
+		_, err := reviews.Unvote(added.Uuid, "user:alice")
+		assert.ErrorContains(t, err, "/not-found", "should need a vote to take back")
+
+		reviews.Vote(added.Uuid, "user:alice", false)
+		unvoted, err := reviews.Unvote(added.Uuid, "user:alice")
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(unvoted.Unhelpful, 0), "should take the vote away")
+	})
+}
+
+func TestVotesOutliveUpdates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		added, _ := reviews.AddReview(Review{Message: "good", Rating: 4})
+		reviews.Vote(added.Uuid, "user:alice", true)
+
+		updated, err := reviews.UpdateReview(added.Uuid, Review{Message: "great", Rating: 5, Helpful: 100}, ANY_VERSION)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(updated.Helpful, 1), "should keep the counts, whatever the update says")
+
+		fresh, _ := reviews.AddReview(Review{Message: "new", Rating: 3, Helpful: 100})
+		assert.Assert(t, is.Equal(fresh.Helpful, 0), "should start without votes")
+	})
+}
+
+func TestVotesFollowTheirReview(t *testing.T) {
+	forEachStore(t, func(t *testing.T, reviews ReviewStore) {
+		_, err := reviews.Vote(uuid.New().String(), "user:alice", true)
+		assert.ErrorContains(t, err, "/not-found")
+
+		added, _ := reviews.AddReview(Review{Message: "poor", Rating: 1})
+		reviews.Vote(added.Uuid, "user:alice", true)
+		reviews.DeleteReview(added.Uuid, ANY_VERSION)
+		_, err = reviews.Vote(added.Uuid, "user:bob", true)
+		assert.ErrorContains(t, err, "/gone", "should not vote on a trashed review")
+
+		restored, _ := reviews.UndeleteReview(added.Uuid)
+		assert.Assert(t, is.Equal(restored.Helpful, 1), "should come back with the review")
+
+		reviews.DeleteReview(added.Uuid, ANY_VERSION)
+		reviews.PurgeDeleted(time.Now().Add(time.Second))
+		_, err = reviews.Unvote(added.Uuid, "user:alice")
+		assert.ErrorContains(t, err, "/not-found", "should be purged with the review")
+	})
+}
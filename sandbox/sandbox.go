@@ -0,0 +1,111 @@
+package sandbox
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"farmstall/problems"
+	"farmstall/reviews"
+	"farmstall/stalls"
+	"farmstall/users"
+)
+
+// Header that selects a sandbox, as an alternative to the /sandboxes/{id} path prefix
+const HEADER = "X-Sandbox-Id"
+
+const BASE_PATH = "/sandboxes"
+
+var validId = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Sandbox is an isolated copy of the stores, for a single learner
+type Sandbox struct {
+	Id       string
+	Reviews  reviews.ReviewStore
+	Users    users.UserStore
+	Stalls   stalls.StallStore
+	lastUsed time.Time
+}
+
+// Manager lazily creates sandboxes, and evicts them once they've been idle for longer than the TTL
+type Manager struct {
+	mu        sync.Mutex
+	sandboxes map[string]*Sandbox
+	ttl       time.Duration
+	max       int
+	// Fills a new sandbox with the starting dataset
+	seed func(*Sandbox) error
+	now  func() time.Time
+}
+
+// NewManager keeps at most max sandboxes in memory, each evicted after ttl of inactivity
+func NewManager(ttl time.Duration, max int, seed func(*Sandbox) error) *Manager {
+	return &Manager{
+		sandboxes: map[string]*Sandbox{},
+		ttl:       ttl,
+		max:       max,
+		seed:      seed,
+		now:       time.Now,
+	}
+}
+
+// Get returns the sandbox with the given id, creating it if needed
+func (m *Manager) Get(id string) (*Sandbox, error) {
+	if !validId.MatchString(id) {
+		return nil, problems.InvalidRequest(problems.ProblemJson{
+			Detail: fmt.Sprintf("Sandbox id, %s, must be 1 to 64 letters, digits, dashes or underscores", id),
+		})
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.evict(now)
+
+	if sb, ok := m.sandboxes[id]; ok {
+		sb.lastUsed = now
+		return sb, nil
+	}
+
+	if len(m.sandboxes) >= m.max {
+		return nil, problems.TooManySandboxes(problems.ProblemJson{
+			Instance: BASE_PATH + "/" + id,
+			Detail:   fmt.Sprintf("All %d sandboxes are in use, try again once one has been idle for %s", m.max, m.ttl),
+		})
+	}
+
+	sb := &Sandbox{
+		Id:       id,
+		Reviews:  reviews.NewReviews(),
+		Users:    users.NewUsers(),
+		Stalls:   stalls.NewStalls(),
+		lastUsed: now,
+	}
+	if err := m.seed(sb); err != nil {
+		return nil, problems.Internal(problems.ProblemJson{
+			Instance: BASE_PATH + "/" + id,
+			Detail:   err.Error(),
+		})
+	}
+	m.sandboxes[id] = sb
+	return sb, nil
+}
+
+// Len is the number of sandboxes currently in memory
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evict(m.now())
+	return len(m.sandboxes)
+}
+
+// Callers must hold m.mu
+func (m *Manager) evict(now time.Time) {
+	for id, sb := range m.sandboxes {
+		if now.Sub(sb.lastUsed) > m.ttl {
+			delete(m.sandboxes, id)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package sandbox
+
+import (
+	"testing"
+	"time"
+
+	"farmstall/reviews"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func seedOneReview(sb *Sandbox) error {
+	_, err := sb.Reviews.AddReview(reviews.Review{
+		Message: "good",
+		Rating:  5,
+	})
+	return err
+}
+
+func TestGetCreatesSeededSandbox(t *testing.T) {
+	m := NewManager(time.Hour, 10, seedOneReview)
+	sb, err := m.Get("learner-1")
+	assert.NilError(t, err, "should have no errors")
+
+	allReviews, _ := sb.Reviews.GetReviews()
+	assert.Assert(t, is.Len(*allReviews, 1), "should be seeded")
+}
+
+func TestSandboxesAreIsolated(t *testing.T) {
+	m := NewManager(time.Hour, 10, seedOneReview)
+	a, _ := m.Get("a")
+	b, _ := m.Get("b")
+
+	a.Reviews.Clear()
+
+	allReviews, _ := b.Reviews.GetReviews()
+	assert.Assert(t, is.Len(*allReviews, 1), "should not be affected by another sandbox")
+
+	again, _ := m.Get("a")
+	allReviews, _ = again.Reviews.GetReviews()
+	assert.Assert(t, is.Len(*allReviews, 0), "should keep the same sandbox for the same id")
+}
+
+func TestInvalidId(t *testing.T) {
+	m := NewManager(time.Hour, 10, seedOneReview)
+	_, err := m.Get("../etc")
+	assert.ErrorContains(t, err, "/invalid-request")
+}
+
+func TestEvictIdleSandboxes(t *testing.T) {
+	now := time.Now()
+	m := NewManager(time.Minute, 10, seedOneReview)
+	m.now = func() time.Time { return now }
+
+	m.Get("a")
+	now = now.Add(30 * time.Second)
+	m.Get("b")
+	now = now.Add(45 * time.Second)
+
+	assert.Assert(t, is.Equal(m.Len(), 1), "should evict the sandbox idle for longer than the TTL")
+}
+
+func TestMaxSandboxes(t *testing.T) {
+	now := time.Now()
+	m := NewManager(time.Minute, 2, seedOneReview)
+	m.now = func() time.Time { return now }
+
+	m.Get("a")
+	m.Get("b")
+	_, err := m.Get("c")
+	assert.ErrorContains(t, err, "/too-many-sandboxes")
+
+	_, err = m.Get("a")
+	assert.NilError(t, err, "should still serve existing sandboxes")
+
+	now = now.Add(2 * time.Minute)
+	_, err = m.Get("c")
+	assert.NilError(t, err, "should make room once sandboxes are evicted")
+}
@@ -0,0 +1,194 @@
+package seed
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"farmstall/reviews"
+	"farmstall/stalls"
+	"farmstall/users"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/ghodss/yaml"
+)
+
+// Passing NONE instead of a file path starts the server without any data
+const NONE = "none"
+
+// Fixture is the starting dataset of the API, loaded from a YAML or JSON file
+type Fixture struct {
+	Users   []User   `json:"users"`
+	Stalls  []Stall  `json:"stalls"`
+	Reviews []Review `json:"reviews"`
+}
+
+type User struct {
+	users.NewUser
+	// Pre-issued token, so exercises can use a well known value
+	Token string `json:"token"`
+}
+
+type Stall struct {
+	stalls.NewStall
+	// Username of the owner
+	Owner string `json:"owner"`
+}
+
+type Review struct {
+	Message string `json:"message"`
+	Rating  int    `json:"rating"`
+	// Username of the author, anonymous when empty
+	Author string `json:"author"`
+	// Name of the stall the review is about, if any
+	Stall string `json:"stall"`
+}
+
+// A section of the fixture is checked against the schema the API accepts for
+// it, with the keys only a fixture has added and the ones it doesn't read left
+// out. Any other key is refused, so a typo like auther isn't silently dropped.
+type section struct {
+	schema string
+	extra  []string
+	omit   []string
+}
+
+var sections = map[string]section{
+	"users":   {schema: "NewUser", extra: []string{"token"}},
+	"stalls":  {schema: "NewStall", extra: []string{"owner"}},
+	"reviews": {schema: "NewReview", extra: []string{"author", "stall"}, omit: []string{"stallId"}},
+}
+
+func (s section) fixtureSchema(api *openapi3.Schema) *openapi3.Schema {
+	schema := *api
+	schema.Properties = make(map[string]*openapi3.SchemaRef, len(api.Properties)+len(s.extra))
+	for name, property := range api.Properties {
+		schema.Properties[name] = property
+	}
+	for _, name := range s.omit {
+		delete(schema.Properties, name)
+	}
+	for _, name := range s.extra {
+		schema.Properties[name] = openapi3.NewSchemaRef("", openapi3.NewStringSchema())
+	}
+	closed := false
+	schema.AdditionalPropertiesAllowed = &closed
+	return &schema
+}
+
+// Load reads a fixture file and validates it against the OpenAPI definition at specPath
+func Load(path string, specPath string) (*Fixture, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is a superset of JSON, so this handles both
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromFile(specPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := Validate(jsonData, swagger); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(jsonData, &fixture); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return &fixture, nil
+}
+
+// Validate checks every user, stall and review in a JSON fixture against its schema in the OpenAPI definition
+func Validate(jsonData []byte, swagger *openapi3.Swagger) error {
+	var raw map[string][]interface{}
+	if err := json.Unmarshal(jsonData, &raw); err != nil {
+		return err
+	}
+
+	for name, items := range raw {
+		s, ok := sections[name]
+		if !ok {
+			return fmt.Errorf("unknown section %q", name)
+		}
+		schemaRef, ok := swagger.Components.Schemas[s.schema]
+		if !ok || schemaRef.Value == nil {
+			return fmt.Errorf("schema %s is missing from the OpenAPI definition", s.schema)
+		}
+		schema := s.fixtureSchema(schemaRef.Value)
+
+		for i, item := range items {
+			if err := schema.VisitJSON(item); err != nil {
+				return fmt.Errorf("%s[%d] does not match %s: %s", name, i, s.schema, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply adds the fixture to the stores. Users are added first, then stalls,
+// so stalls can refer to their owners and reviews to their authors and stalls.
+func Apply(fixture *Fixture, rs reviews.ReviewStore, us users.UserStore, ss stalls.StallStore) error {
+	for _, u := range fixture.Users {
+		if _, err := us.AddUser(u.NewUser); err != nil {
+			return err
+		}
+		if u.Token != "" {
+			_, err := us.CreateToken(users.UserLogin{
+				Username: u.Username,
+				Password: u.Password,
+			}, u.Token)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	stallIds := map[string]string{}
+	for _, s := range fixture.Stalls {
+		owner, err := us.GetUserByUsername(s.Owner)
+		if err != nil {
+			return err
+		}
+		stall, err := ss.AddStall(stalls.Stall{
+			Name:        s.Name,
+			Description: s.Description,
+			Location:    s.Location,
+			OwnerID:     owner.Uuid,
+		})
+		if err != nil {
+			return err
+		}
+		stallIds[s.Name] = stall.Uuid
+	}
+
+	for _, r := range fixture.Reviews {
+		review := reviews.Review{
+			Message: r.Message,
+			Rating:  r.Rating,
+		}
+		if r.Stall != "" {
+			stallId, ok := stallIds[r.Stall]
+			if !ok {
+				return fmt.Errorf("review %q is about an unknown stall, %s", r.Message, r.Stall)
+			}
+			review.StallID = stallId
+		}
+		if r.Author != "" {
+			author, err := us.GetUserByUsername(r.Author)
+			if err != nil {
+				return err
+			}
+			review.UserID = author.Uuid
+		}
+		if _, err := rs.AddReview(review); err != nil {
+			return err
+		}
+	}
+	return nil
+}
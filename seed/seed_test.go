@@ -0,0 +1,149 @@
+package seed
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"farmstall/reviews"
+	"farmstall/stalls"
+	"farmstall/users"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+const SPEC = "../openapi.yaml"
+
+func writeFixture(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NilError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadDefaultSeed(t *testing.T) {
+	fixture, err := Load("../seed.yaml", SPEC)
+	assert.NilError(t, err, "should have no errors")
+	assert.Assert(t, is.Len(fixture.Users, 2), "should load the users")
+	assert.Assert(t, is.Len(fixture.Stalls, 1), "should load the stalls")
+	assert.Assert(t, is.Len(fixture.Reviews, 3), "should load the reviews")
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := writeFixture(t, "seed.json", `{"reviews": [{"message": "good", "rating": 4}]}`)
+	fixture, err := Load(path, SPEC)
+	assert.NilError(t, err, "should have no errors")
+	assert.Assert(t, is.Len(fixture.Reviews, 1), "should load the reviews")
+}
+
+func TestLoadInvalidRating(t *testing.T) {
+	path := writeFixture(t, "seed.yaml", "reviews:\n- message: too good\n  rating: 9\n")
+	_, err := Load(path, SPEC)
+	assert.ErrorContains(t, err, "reviews[0] does not match NewReview")
+}
+
+func TestLoadUnknownKey(t *testing.T) {
+	path := writeFixture(t, "seed.yaml", "reviews:\n- message: good\n  rating: 4\n  auther: ponelat\n")
+	_, err := Load(path, SPEC)
+	assert.ErrorContains(t, err, "Property 'auther' is unsupported")
+
+	path = writeFixture(t, "seed.yaml", "users:\n- username: ponelat\n  tokn: aabbcceeff\n")
+	_, err = Load(path, SPEC)
+	assert.ErrorContains(t, err, "Property 'tokn' is unsupported")
+}
+
+func TestLoadStallIdIsNotRead(t *testing.T) {
+	path := writeFixture(t, "seed.yaml", "reviews:\n- message: good\n  rating: 4\n  stallId: 0b6c6b1e-3a3e-4c43-9c3a-1e1f3c1d2e4f\n")
+	_, err := Load(path, SPEC)
+	assert.ErrorContains(t, err, "Property 'stallId' is unsupported")
+}
+
+func TestLoadUnknownSection(t *testing.T) {
+	path := writeFixture(t, "seed.yaml", "markets:\n- name: Saturday market\n")
+	_, err := Load(path, SPEC)
+	assert.ErrorContains(t, err, `unknown section "markets"`)
+}
+
+func TestApplyWithAuthorsAndTokens(t *testing.T) {
+	path := writeFixture(t, "seed.yaml", `
+users:
+- username: ponelat
+  fullName: Josh Ponelat
+  password: password
+  token: aabbcceeff
+reviews:
+- message: Was awesome!
+  rating: 5
+  author: ponelat
+- message: Was okay.
+  rating: 3
+`)
+	fixture, err := Load(path, SPEC)
+	assert.NilError(t, err, "should have no errors")
+
+	rs := reviews.NewReviews()
+	us := users.NewUsers()
+	assert.NilError(t, Apply(fixture, rs, us, stalls.NewStalls()), "should have no errors")
+
+	user, err := us.UserFromToken("aabbcceeff")
+	assert.NilError(t, err, "should pre-issue the token")
+
+	allReviews, _ := rs.GetReviews()
+	assert.Assert(t, is.Len(*allReviews, 2), "should add every review")
+	authored := 0
+	for _, review := range *allReviews {
+		if review.UserID == user.Uuid {
+			authored++
+		}
+	}
+	assert.Assert(t, is.Equal(authored, 1), "should attribute the review to its author")
+}
+
+func TestApplyUnknownAuthor(t *testing.T) {
+	fixture := &Fixture{
+		Reviews: []Review{{Message: "good", Rating: 5, Author: "nobody"}},
+	}
+	err := Apply(fixture, reviews.NewReviews(), users.NewUsers(), stalls.NewStalls())
+	assert.ErrorContains(t, err, "No user with username, nobody, found")
+}
+
+func TestApplyWithStalls(t *testing.T) {
+	path := writeFixture(t, "seed.yaml", `
+users:
+- username: ponelat
+  fullName: Josh Ponelat
+  password: password
+stalls:
+- name: Ponelat Produce
+  location: R44, Stellenbosch
+  owner: ponelat
+reviews:
+- message: Great avocados
+  rating: 5
+  stall: Ponelat Produce
+`)
+	fixture, err := Load(path, SPEC)
+	assert.NilError(t, err, "should have no errors")
+
+	rs := reviews.NewReviews()
+	us := users.NewUsers()
+	ss := stalls.NewStalls()
+	assert.NilError(t, Apply(fixture, rs, us, ss), "should have no errors")
+
+	owner, _ := us.GetUserByUsername("ponelat")
+	allStalls, _ := ss.GetStalls()
+	assert.Assert(t, is.Len(*allStalls, 1), "should add the stall")
+	stall := (*allStalls)[0]
+	assert.Assert(t, is.Equal(stall.OwnerID, owner.Uuid), "should give the stall its owner")
+
+	allReviews, _ := rs.GetReviews()
+	assert.Assert(t, is.Equal((*allReviews)[0].StallID, stall.Uuid), "should attach the review to the stall")
+}
+
+func TestApplyUnknownStall(t *testing.T) {
+	fixture := &Fixture{
+		Reviews: []Review{{Message: "good", Rating: 5, Stall: "Nowhere"}},
+	}
+	err := Apply(fixture, reviews.NewReviews(), users.NewUsers(), stalls.NewStalls())
+	assert.ErrorContains(t, err, "unknown stall, Nowhere")
+}
@@ -2,22 +2,39 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"mime"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/getkin/kin-openapi/openapi3filter"
 	"github.com/ulule/limiter/v3"
 	"github.com/ulule/limiter/v3/drivers/middleware/stdlib"
 	"github.com/ulule/limiter/v3/drivers/store/memory"
 
+	"farmstall/cursor"
+	"farmstall/database"
+	"farmstall/jwt"
 	"farmstall/openapi"
 	"farmstall/problems"
+	"farmstall/reset"
 	"farmstall/reviews"
+	"farmstall/sandbox"
+	"farmstall/seed"
 	"farmstall/spa"
+	"farmstall/stalls"
 	"farmstall/users"
 
 	"github.com/gorilla/mux"
@@ -25,21 +42,92 @@ import (
 )
 
 type Server struct {
-	Reviews *reviews.Reviews
-	Users   *users.Users
+	Spec      *openapi3.Swagger
+	Reviews   reviews.ReviewStore
+	Users     users.UserStore
+	Stalls    stalls.StallStore
+	Resets    *reset.Scheduler
+	Sandboxes *sandbox.Manager
+	// Usernames allowed to use the admin endpoints
+	Admins map[string]bool
+	// Usernames allowed to moderate reviews, on top of the admins
+	Moderators map[string]bool
+	// Who may change or delete anonymous reviews, ANYONE or ADMINS
+	AnonymousReviewPolicy string
+	// Which new reviews wait for a moderator, PREMODERATE_OFF or PREMODERATE_ANONYMOUS
+	PreModeration string
+	// Signs access tokens when they are ACCESS_JWT, nil when they are ACCESS_OPAQUE
+	AccessKeys *jwt.Keys
+	// How long a signed access token lasts
+	AccessTokenTTL time.Duration
+	// Proxies whose X-Forwarded-For is believed when telling anonymous voters apart
+	TrustedProxies []*net.IPNet
 }
 
+// Policies for changing anonymous reviews
+const (
+	ANYONE = "anyone"
+	ADMINS = "admins"
+)
+
+// Kinds of access token handed out by POST /tokens. Opaque tokens are looked
+// up in the user store, signed ones come with a refresh token and are only
+// checked against their signature.
+const (
+	ACCESS_OPAQUE = "opaque"
+	ACCESS_JWT    = "jwt"
+)
+
+// Pre-moderation modes
+const (
+	PREMODERATE_OFF       = "off"
+	PREMODERATE_ANONYMOUS = "anonymous"
+)
+
 // Set from ENV variable during startup
 var PROBS_URL string
 var BASE_URL string
+var MESSAGE_HTML_PROFILE string
 
 const BASE_PATH string = "/v1"
 
+func init() {
+	// Patches are plain JSON documents, so validate them like any other body
+	openapi3filter.RegisterBodyDecoder(reviews.MERGE_PATCH, decodeJsonBody)
+	openapi3filter.RegisterBodyDecoder(reviews.JSON_PATCH, decodeJsonBody)
+}
+
+func decodeJsonBody(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn openapi3filter.EncodingFn) (interface{}, error) {
+	var value interface{}
+	if err := json.NewDecoder(body).Decode(&value); err != nil {
+		return nil, &openapi3filter.ParseError{Kind: openapi3filter.KindInvalidFormat, Cause: err}
+	}
+	return value, nil
+}
+
 // main
 func main() {
 
 	PORT := os.Getenv("PORT")
 	FQDN := os.Getenv("FQDN")
+	DATABASE_URL := os.Getenv("DATABASE_URL")
+	SEED_FILE := os.Getenv("SEED_FILE")
+	RESET_INTERVAL := os.Getenv("RESET_INTERVAL")
+	ADMIN_USERS := os.Getenv("ADMIN_USERS")
+	MODERATOR_USERS := os.Getenv("MODERATOR_USERS")
+	PRE_MODERATION := os.Getenv("PRE_MODERATION")
+	SANDBOX_TTL := os.Getenv("SANDBOX_TTL")
+	SANDBOX_MAX := os.Getenv("SANDBOX_MAX")
+	ANONYMOUS_REVIEW_POLICY := os.Getenv("ANONYMOUS_REVIEW_POLICY")
+	TRASH_RETENTION := os.Getenv("TRASH_RETENTION")
+	MESSAGE_MIN_LENGTH := os.Getenv("MESSAGE_MIN_LENGTH")
+	MESSAGE_MAX_LENGTH := os.Getenv("MESSAGE_MAX_LENGTH")
+	TOKEN_TTL := os.Getenv("TOKEN_TTL")
+	ACCESS_TOKENS := os.Getenv("ACCESS_TOKENS")
+	JWT_ALG := os.Getenv("JWT_ALG")
+	JWT_KEYS := os.Getenv("JWT_KEYS")
+	JWT_TTL := os.Getenv("JWT_TTL")
+	TRUSTED_PROXIES := os.Getenv("TRUSTED_PROXIES")
 
 	if PORT == "" {
 		PORT = "8080"
@@ -49,30 +137,264 @@ func main() {
 		FQDN = "https://farmstall.designapis.com"
 	}
 
+	if SEED_FILE == "" {
+		SEED_FILE = "seed.yaml"
+	}
+
+	if SANDBOX_TTL == "" {
+		SANDBOX_TTL = "1h"
+	}
+
+	if SANDBOX_MAX == "" {
+		SANDBOX_MAX = "100"
+	}
+
+	if TRASH_RETENTION == "" {
+		TRASH_RETENTION = "720h"
+	}
+
+	if MESSAGE_MIN_LENGTH == "" {
+		MESSAGE_MIN_LENGTH = "0"
+	}
+
+	if MESSAGE_MAX_LENGTH == "" {
+		MESSAGE_MAX_LENGTH = "2000"
+	}
+
+	if TOKEN_TTL == "" {
+		TOKEN_TTL = "24h"
+	}
+
+	if ACCESS_TOKENS == "" {
+		ACCESS_TOKENS = ACCESS_OPAQUE
+	}
+	if ACCESS_TOKENS != ACCESS_OPAQUE && ACCESS_TOKENS != ACCESS_JWT {
+		log.Fatalf("Invalid ACCESS_TOKENS %s, expected %s or %s", ACCESS_TOKENS, ACCESS_OPAQUE, ACCESS_JWT)
+	}
+
+	if JWT_ALG == "" {
+		JWT_ALG = jwt.HS256
+	}
+
+	if JWT_TTL == "" {
+		JWT_TTL = "15m"
+	}
+
+	if PRE_MODERATION == "" {
+		PRE_MODERATION = PREMODERATE_OFF
+	}
+	if PRE_MODERATION != PREMODERATE_OFF && PRE_MODERATION != PREMODERATE_ANONYMOUS {
+		log.Fatalf("Invalid PRE_MODERATION %s, expected %s or %s", PRE_MODERATION, PREMODERATE_OFF, PREMODERATE_ANONYMOUS)
+	}
+
+	if ANONYMOUS_REVIEW_POLICY == "" {
+		ANONYMOUS_REVIEW_POLICY = ANYONE
+	}
+	if ANONYMOUS_REVIEW_POLICY != ANYONE && ANONYMOUS_REVIEW_POLICY != ADMINS {
+		log.Fatalf("Invalid ANONYMOUS_REVIEW_POLICY %s, expected %s or %s", ANONYMOUS_REVIEW_POLICY, ANYONE, ADMINS)
+	}
+
 	// Set global
 	PROBS_URL = FQDN + "/probs"
 	BASE_URL = FQDN + BASE_PATH
+	MESSAGE_HTML_PROFILE = FQDN + "/profiles/message-html"
+
+	// Checked by the review stores, sandboxes included
+	minLength, err := strconv.Atoi(MESSAGE_MIN_LENGTH)
+	if err != nil || minLength < 0 {
+		log.Fatalf("Invalid MESSAGE_MIN_LENGTH %s, expected a number of characters", MESSAGE_MIN_LENGTH)
+	}
+	maxLength, err := strconv.Atoi(MESSAGE_MAX_LENGTH)
+	if err != nil || maxLength < 0 || (maxLength != 0 && maxLength < minLength) {
+		log.Fatalf("Invalid MESSAGE_MAX_LENGTH %s, expected a number of characters no less than MESSAGE_MIN_LENGTH, or 0 for no limit", MESSAGE_MAX_LENGTH)
+	}
+	reviews.MessageLimits = reviews.Limits{Min: minLength, Max: maxLength}
+
+	// Checked by the user stores, sandboxes included
+	tokenTTL, err := time.ParseDuration(TOKEN_TTL)
+	if err != nil || tokenTTL < 0 {
+		log.Fatalf("Invalid TOKEN_TTL %s, expected a positive duration, or 0 for tokens that never expire", TOKEN_TTL)
+	}
+	users.TokenTTL = tokenTTL
+
+	spec, err := openapi3.NewSwaggerLoader().LoadSwaggerFromFile("openapi.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load openapi.yaml. Error: %s", err)
+	}
 
 	server := Server{
-		Reviews: reviews.NewReviews(),
-		Users:   users.NewUsers(),
+		Spec:                  spec,
+		Reviews:               reviews.NewReviews(),
+		Users:                 users.NewUsers(),
+		Stalls:                stalls.NewStalls(),
+		Admins:                map[string]bool{},
+		Moderators:            map[string]bool{},
+		AnonymousReviewPolicy: ANONYMOUS_REVIEW_POLICY,
+		PreModeration:         PRE_MODERATION,
+	}
+
+	if ACCESS_TOKENS == ACCESS_JWT {
+		server.AccessKeys, err = jwt.ParseKeys(JWT_ALG, JWT_KEYS)
+		if err != nil {
+			log.Fatalf("Invalid JWT_ALG or JWT_KEYS. Error: %s", err)
+		}
+		server.AccessTokenTTL, err = time.ParseDuration(JWT_TTL)
+		if err != nil || server.AccessTokenTTL <= 0 {
+			log.Fatalf("Invalid JWT_TTL %s, expected a positive duration", JWT_TTL)
+		}
+	}
+
+	for _, username := range strings.Split(ADMIN_USERS, ",") {
+		if username = strings.TrimSpace(username); username != "" {
+			server.Admins[username] = true
+		}
+	}
+	for _, username := range strings.Split(MODERATOR_USERS, ",") {
+		if username = strings.TrimSpace(username); username != "" {
+			server.Moderators[username] = true
+		}
+	}
+	for _, proxy := range strings.Split(TRUSTED_PROXIES, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			log.Fatalf("Invalid TRUSTED_PROXIES %s, expected comma separated addresses or CIDRs", TRUSTED_PROXIES)
+		}
+		server.TrustedProxies = append(server.TrustedProxies, network)
+	}
+
+	// Persist to a database, if one was given. Otherwise everything lives in memory
+	if DATABASE_URL != "" {
+		db, err := database.Open(DATABASE_URL)
+		if err != nil {
+			log.Fatalf("Failed to open database %s. Error: %s", DATABASE_URL, err)
+		}
+		defer db.Close()
+
+		server.Reviews = reviews.NewSQLReviews(db)
+		server.Users = users.NewSQLUsers(db)
+		server.Stalls = stalls.NewSQLStalls(db)
+	}
+
+	fixture := loadSeed(SEED_FILE)
+	if server.isEmpty() {
+		if err := server.restore(fixture); err != nil {
+			log.Fatalf("Failed to apply seed data from %s. Error: %s", SEED_FILE, err)
+		}
+	}
+
+	// Put the demo data back on occasion
+	var resetInterval time.Duration
+	if RESET_INTERVAL != "" {
+		var err error
+		resetInterval, err = time.ParseDuration(RESET_INTERVAL)
+		if err != nil {
+			log.Fatalf("Invalid RESET_INTERVAL %s. Error: %s", RESET_INTERVAL, err)
+		}
+	}
+	server.Resets = reset.NewScheduler(resetInterval, func() error {
+		if err := server.Reviews.Clear(); err != nil {
+			return err
+		}
+		if err := server.Stalls.Clear(); err != nil {
+			return err
+		}
+		if err := server.Users.Clear(); err != nil {
+			return err
+		}
+		return server.restore(fixture)
+	})
+	server.Resets.Start()
+
+	// Empty the trash of anything older than the retention period
+	trashRetention, err := time.ParseDuration(TRASH_RETENTION)
+	if err != nil || trashRetention <= 0 {
+		log.Fatalf("Invalid TRASH_RETENTION %s, expected a positive duration", TRASH_RETENTION)
 	}
+	go server.purgeTrash(trashRetention)
 
-	server.initDummyData()
+	// Isolated copies of the seed data, one per learner
+	sandboxTTL, err := time.ParseDuration(SANDBOX_TTL)
+	if err != nil {
+		log.Fatalf("Invalid SANDBOX_TTL %s. Error: %s", SANDBOX_TTL, err)
+	}
+	sandboxMax, err := strconv.Atoi(SANDBOX_MAX)
+	if err != nil {
+		log.Fatalf("Invalid SANDBOX_MAX %s. Error: %s", SANDBOX_MAX, err)
+	}
+	server.Sandboxes = sandbox.NewManager(sandboxTTL, sandboxMax, func(sb *sandbox.Sandbox) error {
+		if fixture == nil {
+			return nil
+		}
+		return seed.Apply(fixture, sb.Reviews, sb.Users, sb.Stalls)
+	})
 	m := mux.NewRouter()
 
 	// API
 	api := m.PathPrefix(BASE_PATH).Subrouter()
+	api.Use(server.sandboxMiddleware)
 	api.Use(server.validateRequestMiddleware)
 
 	api.HandleFunc("/reviews", server.getReviews()).Methods(http.MethodGet)
 	api.HandleFunc("/reviews", server.addReview()).Methods(http.MethodPost)
+	api.HandleFunc("/reviews/stats", server.getReviewStats()).Methods(http.MethodGet)
 	api.HandleFunc("/reviews/{reviewId}", server.getReview()).Methods(http.MethodGet)
 	api.HandleFunc("/reviews/{reviewId}", server.deleteReview()).Methods(http.MethodDelete)
 	api.HandleFunc("/reviews/{reviewId}", server.updateReview()).Methods(http.MethodPut)
-
+	api.HandleFunc("/reviews/{reviewId}", server.patchReview()).Methods(http.MethodPatch)
+	api.HandleFunc("/reviews/{reviewId}/revisions", server.getRevisions()).Methods(http.MethodGet)
+	api.HandleFunc("/reviews/{reviewId}/revisions/{revision}", server.getRevision()).Methods(http.MethodGet)
+	api.HandleFunc("/reviews/{reviewId}/revisions/{revision}/restore", server.restoreRevision()).Methods(http.MethodPost)
+	api.HandleFunc("/reviews/{reviewId}/vote", server.voteReview()).Methods(http.MethodPut)
+	api.HandleFunc("/reviews/{reviewId}/vote", server.unvoteReview()).Methods(http.MethodDelete)
+	api.HandleFunc("/reviews/{reviewId}/replies", server.getReplies()).Methods(http.MethodGet)
+	api.HandleFunc("/reviews/{reviewId}/replies", server.addReply()).Methods(http.MethodPost)
+	api.HandleFunc("/reviews/{reviewId}/replies/{replyId}", server.getReply()).Methods(http.MethodGet)
+	api.HandleFunc("/reviews/{reviewId}/replies/{replyId}", server.updateReply()).Methods(http.MethodPut)
+	api.HandleFunc("/reviews/{reviewId}/replies/{replyId}", server.deleteReply()).Methods(http.MethodDelete)
+
+	api.HandleFunc("/stalls", server.getStalls()).Methods(http.MethodGet)
+	api.HandleFunc("/stalls", server.addStall()).Methods(http.MethodPost)
+	api.HandleFunc("/stalls/{stallId}", server.getStall()).Methods(http.MethodGet)
+	api.HandleFunc("/stalls/{stallId}", server.updateStall()).Methods(http.MethodPut)
+	api.HandleFunc("/stalls/{stallId}", server.deleteStall()).Methods(http.MethodDelete)
+	api.HandleFunc("/stalls/{stallId}/reviews", server.getReviews()).Methods(http.MethodGet)
+	api.HandleFunc("/stalls/{stallId}/reviews", server.addReview()).Methods(http.MethodPost)
+
+	api.HandleFunc("/reviews/{reviewId}/flags", server.flagReview()).Methods(http.MethodPost)
+	api.HandleFunc("/moderation/queue", server.getModerationQueue()).Methods(http.MethodGet)
+	api.HandleFunc("/moderation/reviews/{reviewId}/approve", server.moderateReview(reviews.PUBLISHED)).Methods(http.MethodPost)
+	api.HandleFunc("/moderation/reviews/{reviewId}/reject", server.moderateReview(reviews.REJECTED)).Methods(http.MethodPost)
+	api.HandleFunc("/moderation/reviews/{reviewId}/hide", server.moderateReview(reviews.HIDDEN)).Methods(http.MethodPost)
+
+	api.HandleFunc("/trash/reviews", server.getTrash()).Methods(http.MethodGet)
+	api.HandleFunc("/trash/reviews/{reviewId}/restore", server.undeleteReview()).Methods(http.MethodPost)
+
+	api.HandleFunc("/users", server.getUsers()).Methods(http.MethodGet)
 	api.HandleFunc("/users", server.addUser()).Methods(http.MethodPost)
+	api.HandleFunc("/users/{userId}", server.getUser()).Methods(http.MethodGet)
+	api.HandleFunc("/users/{userId}", server.patchUser()).Methods(http.MethodPatch)
+	api.HandleFunc("/users/{userId}", server.deleteUser()).Methods(http.MethodDelete)
+	api.HandleFunc("/users/{userId}/reviews", server.getReviews()).Methods(http.MethodGet)
+	api.HandleFunc("/me", server.getMe()).Methods(http.MethodGet)
+	api.HandleFunc("/me/reviews", server.getMyReviews()).Methods(http.MethodGet)
+	api.HandleFunc("/tokens", server.getTokens()).Methods(http.MethodGet)
 	api.HandleFunc("/tokens", server.createToken()).Methods(http.MethodPost)
+	api.HandleFunc("/tokens", server.deleteTokens()).Methods(http.MethodDelete)
+	api.HandleFunc("/tokens/refresh", server.refreshToken()).Methods(http.MethodPost)
+	api.HandleFunc("/tokens/{tokenId}", server.deleteToken()).Methods(http.MethodDelete)
+
+	api.HandleFunc("/reset", server.getResetStatus()).Methods(http.MethodGet)
+	api.HandleFunc("/reset", server.resetNow()).Methods(http.MethodPost)
 
 	// UI
 	m.HandleFunc("/health", server.health())
@@ -87,6 +409,7 @@ func main() {
 		AllowCredentials: true,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{"ETag", "Link", "X-Next-Cursor"},
 		AllowOriginFunc:  func(origin string) bool { return true },
 	})
 
@@ -94,7 +417,7 @@ func main() {
 	m.PathPrefix("/").Handler(spa)
 
 	// Wrap in CORS
-	handler := c.Handler(m)
+	handler := c.Handler(sandboxPrefix(m))
 
 	// Create a rate limiter, 1 per second ( 3600 per hour )
 	rate, _ := limiter.NewRateFromFormatted("36-M")
@@ -115,42 +438,395 @@ func main() {
 	}
 }
 
-func (ctx *Server) initDummyData() {
-	ctx.Reviews.AddReview(reviews.Review{
-		Message: "Was awesome!",
-		Rating:  5,
+// A persistent store keeps its data between restarts, so only seed an empty one
+func (ctx *Server) isEmpty() bool {
+	reviewList, reviewErr := ctx.Reviews.GetReviews()
+	userList, userErr := ctx.Users.GetUsers()
+	stallList, stallErr := ctx.Stalls.GetStalls()
+	if reviewErr != nil || userErr != nil || stallErr != nil {
+		return false
+	}
+	return len(*reviewList) == 0 && len(*userList) == 0 && len(*stallList) == 0
+}
+
+// Load the starting dataset from a fixture file, unless asked to start empty
+func loadSeed(path string) *seed.Fixture {
+	if path == seed.NONE {
+		log.Printf("Starting without seed data")
+		return nil
+	}
+
+	fixture, err := seed.Load(path, "openapi.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load seed data. Error: %s", err)
+	}
+	return fixture
+}
+
+// Add the starting dataset to the stores, if there is one
+func (ctx *Server) restore(fixture *seed.Fixture) error {
+	if fixture == nil {
+		return nil
+	}
+	return seed.Apply(fixture, ctx.Reviews, ctx.Users, ctx.Stalls)
+}
+
+type contextKey string
+
+const sandboxKey contextKey = "sandbox"
+
+// Serve /v1/sandboxes/{id}/... as /v1/..., passing the id along in the sandbox header
+func sandboxPrefix(next http.Handler) http.Handler {
+	prefix := BASE_PATH + sandbox.BASE_PATH + "/"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, prefix), "/", 2)
+			r.Header.Set(sandbox.HEADER, parts[0])
+			r.URL.Path = BASE_PATH
+			if len(parts) == 2 {
+				r.URL.Path += "/" + parts[1]
+			}
+			r.URL.RawPath = ""
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Attach the requested sandbox, if any, for reviewStore, userStore and stallStore to pick up
+func (ctx *Server) sandboxMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(sandbox.HEADER)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sb, err := ctx.Sandboxes.Get(id)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sandboxKey, sb)))
+	})
+}
+
+func sandboxFrom(r *http.Request) *sandbox.Sandbox {
+	sb, _ := r.Context().Value(sandboxKey).(*sandbox.Sandbox)
+	return sb
+}
+
+// The reviews of the request's sandbox, or the shared ones
+func (ctx *Server) reviewStore(r *http.Request) reviews.ReviewStore {
+	if sb := sandboxFrom(r); sb != nil {
+		return sb.Reviews
+	}
+	return ctx.Reviews
+}
+
+// The users of the request's sandbox, or the shared ones
+func (ctx *Server) userStore(r *http.Request) users.UserStore {
+	if sb := sandboxFrom(r); sb != nil {
+		return sb.Users
+	}
+	return ctx.Users
+}
+
+// The stalls of the request's sandbox, or the shared ones
+func (ctx *Server) stallStore(r *http.Request) stalls.StallStore {
+	if sb := sandboxFrom(r); sb != nil {
+		return sb.Stalls
+	}
+	return ctx.Stalls
+}
+
+// The token in the Authorization header. The Bearer scheme is optional, a
+// bare token is still accepted as it always has been.
+func bearerToken(r *http.Request) string {
+	token := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(token) > 7 && strings.EqualFold(token[:7], "Bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+	return token
+}
+
+// Resolve the user behind the Authorization header
+func (ctx *Server) authenticate(r *http.Request) (*users.User, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, problems.InvalidCreds(problems.ProblemJson{
+			Detail: "Missing token",
+		})
+	}
+	if ctx.AccessKeys == nil || !jwt.Looks(token) {
+		return ctx.userStore(r).UserFromToken(token)
+	}
+
+	claims, err := ctx.AccessKeys.Verify(token, time.Now())
+	if err == jwt.ErrExpired {
+		return nil, problems.TokenExpired(problems.ProblemJson{
+			Detail: fmt.Sprintf("The token expired at %s, refresh it with POST /tokens/refresh", time.Unix(claims.ExpiresAt, 0).UTC().Format(time.RFC3339)),
+		})
+	}
+	if err != nil {
+		return nil, problems.InvalidCreds(problems.ProblemJson{
+			Detail: "Invalid token",
+		})
+	}
+	// The signature only says who the token was for. Its session may have
+	// been ended since, or the user deleted along with their sessions.
+	return ctx.userStore(r).UserFromSession(claims.Subject, claims.Session)
+}
+
+// Swap the token in res for a signed access token, leaving the store's own
+// token as the refresh token. Does nothing unless access tokens are signed.
+func (ctx *Server) signAccessToken(res *users.TokenResponse) error {
+	if ctx.AccessKeys == nil {
+		return nil
+	}
+	now := time.Now()
+	claims := jwt.Claims{
+		Subject:   res.UserID,
+		Session:   res.Uuid,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ctx.AccessTokenTTL).Unix(),
+	}
+	signed, err := ctx.AccessKeys.Sign(claims)
+	if err != nil {
+		return problems.Internal(problems.ProblemJson{
+			Detail: err.Error(),
+		})
+	}
+	expiresAt := time.Unix(claims.ExpiresAt, 0).UTC()
+	res.RefreshToken, res.RefreshExpiresAt = res.Token, res.ExpiresAt
+	res.Token, res.ExpiresAt = signed, &expiresAt
+	return nil
+}
+
+// Resolve the user behind the Authorization header, who must be an admin
+func (ctx *Server) authenticateAdmin(r *http.Request) (*users.User, error) {
+	user, err := ctx.authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.isAdmin(user) {
+		return nil, problems.Forbidden(problems.ProblemJson{
+			Detail: fmt.Sprintf("User, %s, is not an admin", user.Username),
+		})
+	}
+	return user, nil
+}
+
+func (ctx *Server) isAdmin(user *users.User) bool {
+	return ctx.Admins[user.Username]
+}
+
+// Admins are moderators too
+func (ctx *Server) isModerator(user *users.User) bool {
+	return ctx.isAdmin(user) || ctx.Moderators[user.Username]
+}
+
+// Resolve the user behind the Authorization header, who must be a moderator
+func (ctx *Server) authenticateModerator(r *http.Request) (*users.User, error) {
+	user, err := ctx.authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.isModerator(user) {
+		return nil, problems.Forbidden(problems.ProblemJson{
+			Detail: fmt.Sprintf("User, %s, is not a moderator", user.Username),
+		})
+	}
+	return user, nil
+}
+
+// Get a review the caller may see. Reviews that aren't published are
+// NotFound to everyone but moderators and their author.
+func (ctx *Server) findReview(r *http.Request, id string) (*reviews.Review, error) {
+	review, err := ctx.reviewStore(r).GetReview(id)
+	if err != nil || review.Status == reviews.PUBLISHED {
+		return review, err
+	}
+	if user, err := ctx.authenticate(r); err == nil {
+		if ctx.isModerator(user) || (review.UserID != "" && review.UserID == user.Uuid) {
+			return review, nil
+		}
+	}
+	return nil, problems.NotFound(problems.ProblemJson{
+		Instance: reviews.BASE_PATH + "/" + id,
 	})
-	ctx.Reviews.AddReview(reviews.Review{
-		Message: "Was okay.",
-		Rating:  3,
+}
+
+// Make sure the caller may change or remove a stall, which only its owner or an admin may
+func (ctx *Server) authorizeStallChange(r *http.Request, stall *stalls.Stall) error {
+	user, err := ctx.authenticate(r)
+	if err != nil {
+		return err
+	}
+	if ctx.isAdmin(user) || stall.OwnerID == user.Uuid {
+		return nil
+	}
+	return problems.NotOwner(problems.ProblemJson{
+		Instance: stalls.BASE_PATH + "/" + stall.Uuid,
+		Detail:   fmt.Sprintf("User, %s, doesn't own this stall", user.Username),
 	})
-	ctx.Reviews.AddReview(reviews.Review{
-		Message: "Was terrible.",
-		Rating:  1,
+}
+
+// Reviews may only be about stalls that exist. An empty stallId is general feedback.
+func (ctx *Server) checkStall(r *http.Request, stallId string) error {
+	if stallId == "" {
+		return nil
+	}
+	_, err := ctx.stallStore(r).GetStall(stallId)
+	if prob, ok := err.(*problems.ProblemJson); ok && prob.Status == 404 {
+		return problems.InvalidReference(problems.ProblemJson{
+			Detail: fmt.Sprintf("Stall, %s, doesn't exist", stallId),
+		})
+	}
+	return err
+}
+
+// The uuid of user, or empty for anonymous callers
+func userId(user *users.User) string {
+	if user == nil {
+		return ""
+	}
+	return user.Uuid
+}
+
+// Make sure the caller may change or delete a review. Authored reviews can
+// only be changed by their author or an admin, anonymous ones depend on the
+// AnonymousReviewPolicy. Returns who is making the change, which is nil for
+// anonymous callers.
+func (ctx *Server) authorizeReviewChange(r *http.Request, review *reviews.Review) (*users.User, error) {
+	instance := reviews.BASE_PATH + "/" + review.Uuid
+
+	if review.UserID == "" && ctx.AnonymousReviewPolicy == ANYONE {
+		// A token isn't needed, but note who made the change if there is one
+		if user, err := ctx.authenticate(r); err == nil {
+			return user, nil
+		}
+		return nil, nil
+	}
+
+	user, err := ctx.authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.isAdmin(user) || (review.UserID != "" && review.UserID == user.Uuid) {
+		return user, nil
+	}
+
+	if review.UserID == "" {
+		return nil, problems.NotOwner(problems.ProblemJson{
+			Instance: instance,
+			Detail:   "Only admins may change anonymous reviews",
+		})
+	}
+	return nil, problems.NotOwner(problems.ProblemJson{
+		Instance: instance,
+		Detail:   fmt.Sprintf("User, %s, is not the author of this review", user.Username),
 	})
+}
 
-	ctx.Users.AddUser(users.NewUser{
-		Username: "ponelat",
-		FullName: "Josh Ponelat",
-		Password: "password",
+// Make sure the caller may reply to a review, which the owner of the stall it
+// is about, its author and admins may
+func (ctx *Server) authorizeReply(r *http.Request, review *reviews.Review) (*users.User, error) {
+	user, err := ctx.authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.isAdmin(user) || (review.UserID != "" && review.UserID == user.Uuid) {
+		return user, nil
+	}
+	if review.StallID != "" {
+		if stall, err := ctx.stallStore(r).GetStall(review.StallID); err == nil && stall.OwnerID == user.Uuid {
+			return user, nil
+		}
+	}
+	return nil, problems.Forbidden(problems.ProblemJson{
+		Instance: reviews.BASE_PATH + "/" + review.Uuid,
+		Detail:   fmt.Sprintf("User, %s, may not reply. Only the stall's owner, the review's author and admins may", user.Username),
 	})
+}
 
-	ctx.Users.AddUser(users.NewUser{
-		Username: "mckenzie",
-		FullName: "Bob McKenzie",
-		Password: "password",
+// Make sure the caller may change or delete a reply, which only its author or an admin may
+func (ctx *Server) authorizeReplyChange(r *http.Request, reply *reviews.Reply) error {
+	user, err := ctx.authenticate(r)
+	if err != nil {
+		return err
+	}
+	if ctx.isAdmin(user) || reply.UserID == user.Uuid {
+		return nil
+	}
+	return problems.NotOwner(problems.ProblemJson{
+		Instance: reviews.BASE_PATH + "/" + reply.ReviewID + "/replies/" + reply.Uuid,
+		Detail:   fmt.Sprintf("User, %s, is not the author of this reply", user.Username),
 	})
+}
+
+// Who is voting. Users get one vote per review, whichever client they use.
+// Anonymous callers are told apart by their address, which is hashed so it
+// isn't kept.
+func (ctx *Server) voter(r *http.Request) (string, *users.User, error) {
+	if r.Header.Get("Authorization") != "" {
+		user, err := ctx.authenticate(r)
+		if err != nil {
+			return "", nil, err
+		}
+		return "user:" + user.Uuid, user, nil
+	}
+
+	fingerprint := sha256.Sum256([]byte(ctx.clientAddress(r)))
+	return "anon:" + hex.EncodeToString(fingerprint[:]), nil, nil
+}
 
-	ctx.Users.CreateToken(users.UserLogin{
-		Username: "ponelat",
-		Password: "password",
-	}, "aabbcceeff")
+// The address a request came from. X-Forwarded-For is anyone's to write, so
+// it's only read when the request came through one of TrustedProxies, and
+// then the client is the nearest hop that isn't another trusted proxy.
+func (ctx *Server) clientAddress(r *http.Request) string {
+	address := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	if !ctx.trustedProxy(address) {
+		return address
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		address = hop
+		if !ctx.trustedProxy(hop) {
+			break
+		}
+	}
+	return address
+}
 
-	ctx.Users.CreateToken(users.UserLogin{
-		Username: "mckenzie",
-		Password: "password",
-	}, "aabbcceefg")
+func (ctx *Server) trustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range ctx.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
 
+// Validate a decoded JSON document against one of the schemas in openapi.yaml
+func (ctx *Server) validateSchema(name string) func(doc interface{}) error {
+	return func(doc interface{}) error {
+		err := ctx.Spec.Components.Schemas[name].Value.VisitJSON(doc)
+		if schemaErr, ok := err.(*openapi3.SchemaError); ok {
+			return errors.New(schemaErr.Reason)
+		}
+		return err
+	}
 }
 
 // Validate the incoming request against our schema(s)
@@ -179,6 +855,27 @@ func (ctx *Server) validateRequestMiddleware(next http.Handler) http.Handler {
 		if err := openapi3filter.ValidateRequest(something, requestValidationInput); err != nil {
 			switch errVal := err.(type) {
 			case *openapi3filter.RequestError:
+				if errVal.Parameter != nil {
+					detail := fmt.Sprintf("%s parameter, %s, is invalid", strings.Title(errVal.Parameter.In), errVal.Parameter.Name)
+					if schemaErr, ok := errVal.Err.(*openapi3.SchemaError); ok {
+						detail += ": " + schemaErr.Reason
+					} else if errVal.Err != nil {
+						detail += ": " + errVal.Err.Error()
+					}
+					ErrorResponse(problems.InvalidRequest(problems.ProblemJson{
+						Detail: detail,
+					}))(w, r)
+					return
+				}
+				if body := route.Operation.RequestBody; body != nil && body.Value != nil {
+					mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+					if body.Value.GetMediaType(mediaType) == nil {
+						ErrorResponse(problems.UnsupportedMediaType(problems.ProblemJson{
+							Detail: fmt.Sprintf("Content-Type %q isn't accepted here", mediaType),
+						}))(w, r)
+						return
+					}
+				}
 				ErrorResponse(problems.InvalidBody(problems.ProblemJson{
 					Detail: errVal.Reason,
 				}))(w, r)
@@ -204,6 +901,37 @@ func (ctx *Server) health() MiddlewareFn {
 	}
 }
 
+func (ctx *Server) getResetStatus() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJson(200, ctx.Resets.Status())(w, r)
+	}
+}
+
+func (ctx *Server) resetNow() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if sandboxFrom(r) != nil {
+			ErrorResponse(problems.InvalidRequest(problems.ProblemJson{
+				Detail: "Resets only apply to the shared data, sandboxes are evicted once idle instead",
+			}))(w, r)
+			return
+		}
+
+		if _, err := ctx.authenticateAdmin(r); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		status, err := ctx.Resets.Reset()
+		if err != nil {
+			ErrorResponse(problems.Internal(problems.ProblemJson{
+				Detail: err.Error(),
+			}))(w, r)
+			return
+		}
+		writeJson(200, status)(w, r)
+	}
+}
+
 func (ctx *Server) updateReview() MiddlewareFn {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var err error
@@ -220,36 +948,684 @@ func (ctx *Server) updateReview() MiddlewareFn {
 			return
 		}
 
-		reviewRes, err := ctx.Reviews.UpdateReview(reviewId, review)
+		existing, err := ctx.findReview(r, reviewId)
+		if err != nil {
+			prob := err.(*problems.ProblemJson)
+			if prob.Status == 404 {
+				prob = problems.UpdateNonExisting(problems.ProblemJson{
+					Instance: reviews.BASE_PATH + "/" + reviewId,
+				})
+			}
+			ErrorResponse(prob)(w, r)
+			return
+		}
+		user, err := ctx.authorizeReviewChange(r, existing)
 		if err != nil {
 			ErrorResponse(err.(*problems.ProblemJson))(w, r)
-		} else {
-			// Empty response
-			writeJson(200, reviewRes)(w, r)
+			return
 		}
-	}
-}
 
-func (ctx *Server) deleteReview() MiddlewareFn {
-	return func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		reviewId := vars["reviewId"]
-		err := ctx.Reviews.DeleteReview(reviewId)
+		version, err := ifMatchVersion(r, existing)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		// The author can't be changed
+		review.UserID = existing.UserID
+		review.UpdatedBy = userId(user)
+
+		if err := ctx.checkStall(r, review.StallID); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		reviewRes, err := ctx.reviewStore(r).UpdateReview(reviewId, review, version)
 		if err != nil {
 			ErrorResponse(err.(*problems.ProblemJson))(w, r)
 		} else {
-			// Empty response
-			w.WriteHeader(204)
-			w.Write(nil)
+			writeReview(200, reviewRes)(w, r)
 		}
 	}
-
 }
 
-func (ctx *Server) addUser() MiddlewareFn {
+func (ctx *Server) patchReview() MiddlewareFn {
 	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		reviewId := vars["reviewId"]
 
-		decoder := json.NewDecoder(r.Body)
+		patch, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			ErrorResponse(problems.InvalidBody(problems.ProblemJson{
+				Detail: err.Error(),
+			}))(w, r)
+			return
+		}
+
+		existing, err := ctx.findReview(r, reviewId)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		user, err := ctx.authorizeReviewChange(r, existing)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		version, err := ifMatchVersion(r, existing)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		review, err := reviews.ApplyPatch(*existing, r.Header.Get("Content-Type"), patch, ctx.validateSchema("Review"))
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		review.UpdatedBy = userId(user)
+
+		if err := ctx.checkStall(r, review.StallID); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		// The patch was worked out against this version, so don't apply it to any other
+		if version == reviews.ANY_VERSION {
+			version = existing.Version
+		}
+		reviewRes, err := ctx.reviewStore(r).UpdateReview(reviewId, *review, version)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeReview(200, reviewRes)(w, r)
+	}
+}
+
+func (ctx *Server) deleteReview() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		reviewId := vars["reviewId"]
+
+		existing, err := ctx.findReview(r, reviewId)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		_, err = ctx.authorizeReviewChange(r, existing)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		version, err := ifMatchVersion(r, existing)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		err = ctx.reviewStore(r).DeleteReview(reviewId, version)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+		} else {
+			// Empty response
+			w.WriteHeader(204)
+			w.Write(nil)
+		}
+	}
+
+}
+
+func (ctx *Server) getStalls() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stallList, err := ctx.stallStore(r).GetStalls()
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeJson(200, stallList)(w, r)
+	}
+}
+
+func (ctx *Server) getStall() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		stall, err := ctx.stallStore(r).GetStall(vars["stallId"])
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeJson(200, stall)(w, r)
+	}
+}
+
+func (ctx *Server) addStall() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var newStall stalls.NewStall
+		if err := json.NewDecoder(r.Body).Decode(&newStall); err != nil {
+			ErrorResponse(problems.FailedToParseJson(problems.ProblemJson{
+				Detail: err.Error(),
+			}))(w, r)
+			return
+		}
+
+		user, err := ctx.authenticate(r)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		stall, err := ctx.stallStore(r).AddStall(stalls.Stall{
+			Name:        newStall.Name,
+			Description: newStall.Description,
+			Location:    newStall.Location,
+			OwnerID:     user.Uuid,
+		})
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeJson(201, stall)(w, r)
+	}
+}
+
+func (ctx *Server) updateStall() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		stallId := vars["stallId"]
+
+		var newStall stalls.NewStall
+		if err := json.NewDecoder(r.Body).Decode(&newStall); err != nil {
+			ErrorResponse(problems.FailedToParseJson(problems.ProblemJson{
+				Detail: err.Error(),
+			}))(w, r)
+			return
+		}
+
+		existing, err := ctx.stallStore(r).GetStall(stallId)
+		if err != nil {
+			prob := err.(*problems.ProblemJson)
+			if prob.Status == 404 {
+				prob = problems.UpdateNonExisting(problems.ProblemJson{
+					Instance: stalls.BASE_PATH + "/" + stallId,
+				})
+			}
+			ErrorResponse(prob)(w, r)
+			return
+		}
+		if err := ctx.authorizeStallChange(r, existing); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		// The owner can't be changed
+		stall, err := ctx.stallStore(r).UpdateStall(stallId, stalls.Stall{
+			Name:        newStall.Name,
+			Description: newStall.Description,
+			Location:    newStall.Location,
+			OwnerID:     existing.OwnerID,
+		})
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeJson(200, stall)(w, r)
+	}
+}
+
+// Stalls with reviews, even trashed ones, can't be removed, or the reviews would point nowhere
+func (ctx *Server) deleteStall() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		stallId := vars["stallId"]
+
+		existing, err := ctx.stallStore(r).GetStall(stallId)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		if err := ctx.authorizeStallChange(r, existing); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		live, err := ctx.reviewStore(r).GetReviewsFiltered(reviews.ReviewFilters{StallID: stallId})
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		trash, err := ctx.reviewStore(r).GetTrash()
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		count := len(*live)
+		for _, review := range *trash {
+			if review.StallID == stallId {
+				count++
+			}
+		}
+		if count > 0 {
+			ErrorResponse(problems.InUse(problems.ProblemJson{
+				Instance: stalls.BASE_PATH + "/" + stallId,
+				Detail:   fmt.Sprintf("The stall still has %d reviews, including any in the trash", count),
+			}))(w, r)
+			return
+		}
+
+		if err := ctx.stallStore(r).DeleteStall(stallId); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		w.WriteHeader(204)
+		w.Write(nil)
+	}
+}
+
+// Anyone may report a review, once. Reporting it again replaces the reason.
+func (ctx *Server) flagReview() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		reviewId := vars["reviewId"]
+
+		var newFlag reviews.NewFlag
+		if err := json.NewDecoder(r.Body).Decode(&newFlag); err != nil {
+			ErrorResponse(problems.FailedToParseJson(problems.ProblemJson{
+				Detail: err.Error(),
+			}))(w, r)
+			return
+		}
+
+		reporter, _, err := ctx.voter(r)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		if _, err := ctx.findReview(r, reviewId); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		flag, err := ctx.reviewStore(r).AddFlag(reviewId, reviews.Flag{
+			Reason:   newFlag.Reason,
+			Reporter: reporter,
+		})
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeJson(201, flag)(w, r)
+	}
+}
+
+func (ctx *Server) getModerationQueue() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ctx.authenticateModerator(r); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		queue, err := ctx.reviewStore(r).GetQueue()
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		for i := range *queue {
+			review := &(*queue)[i].Review
+			renderMessage(w, r, review.Message, &review.MessageHTML)
+		}
+		writeJson(200, queue)(w, r)
+	}
+}
+
+// Approve, reject or hide a review, which resolves its flags
+func (ctx *Server) moderateReview(status string) MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if _, err := ctx.authenticateModerator(r); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		review, err := ctx.reviewStore(r).Moderate(vars["reviewId"], status)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeReview(200, review)(w, r)
+	}
+}
+
+func (ctx *Server) getTrash() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ctx.authenticateAdmin(r); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		trash, err := ctx.reviewStore(r).GetTrash()
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		for i := range *trash {
+			review := &(*trash)[i]
+			renderMessage(w, r, review.Message, &review.MessageHTML)
+		}
+		writeJson(200, trash)(w, r)
+	}
+}
+
+func (ctx *Server) undeleteReview() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if _, err := ctx.authenticateAdmin(r); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		review, err := ctx.reviewStore(r).UndeleteReview(vars["reviewId"])
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeReview(200, review)(w, r)
+	}
+}
+
+// Hard delete reviews that have been in the shared trash for longer than
+// retention. Sandboxes don't need this, they are thrown away once idle.
+func (ctx *Server) purgeTrash(retention time.Duration) {
+	every := time.Hour
+	if retention < every {
+		every = retention
+	}
+	for range time.Tick(every) {
+		purged, err := ctx.Reviews.PurgeDeleted(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Purging the trash failed. Error: %s", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Purged %d reviews from the trash", purged)
+		}
+	}
+}
+
+func (ctx *Server) getRevisions() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if _, err := ctx.findReview(r, vars["reviewId"]); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		history, err := ctx.reviewStore(r).GetRevisions(vars["reviewId"])
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeJson(200, history)(w, r)
+	}
+}
+
+func (ctx *Server) getRevision() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if _, err := ctx.findReview(r, vars["reviewId"]); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		number, _ := strconv.Atoi(vars["revision"])
+		revision, err := ctx.reviewStore(r).GetRevision(vars["reviewId"], number)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeJson(200, revision)(w, r)
+	}
+}
+
+// Make an old revision the current one. This adds a new revision, so the
+// history is never rewritten.
+func (ctx *Server) restoreRevision() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		reviewId := vars["reviewId"]
+		number, _ := strconv.Atoi(vars["revision"])
+
+		existing, err := ctx.findReview(r, reviewId)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		user, err := ctx.authorizeReviewChange(r, existing)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		version, err := ifMatchVersion(r, existing)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		if version == reviews.ANY_VERSION {
+			version = existing.Version
+		}
+
+		revision, err := ctx.reviewStore(r).GetRevision(reviewId, number)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		reviewRes, err := ctx.reviewStore(r).UpdateReview(reviewId, reviews.Review{
+			Message:   revision.Message,
+			Rating:    revision.Rating,
+			UserID:    existing.UserID,
+			StallID:   existing.StallID,
+			UpdatedBy: userId(user),
+		}, version)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeReview(200, reviewRes)(w, r)
+	}
+}
+
+func (ctx *Server) voteReview() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		reviewId := vars["reviewId"]
+
+		var vote reviews.Vote
+		if err := json.NewDecoder(r.Body).Decode(&vote); err != nil {
+			ErrorResponse(problems.FailedToParseJson(problems.ProblemJson{
+				Detail: err.Error(),
+			}))(w, r)
+			return
+		}
+
+		voter, user, err := ctx.voter(r)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		existing, err := ctx.findReview(r, reviewId)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		if user != nil && existing.UserID == user.Uuid {
+			ErrorResponse(problems.Forbidden(problems.ProblemJson{
+				Instance: reviews.BASE_PATH + "/" + reviewId + "/vote",
+				Detail:   "Authors can't vote on their own reviews",
+			}))(w, r)
+			return
+		}
+
+		review, err := ctx.reviewStore(r).Vote(reviewId, voter, vote.Helpful)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeReview(200, review)(w, r)
+	}
+}
+
+func (ctx *Server) unvoteReview() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		voter, _, err := ctx.voter(r)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		if _, err := ctx.reviewStore(r).Unvote(vars["reviewId"], voter); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		w.WriteHeader(204)
+		w.Write(nil)
+	}
+}
+
+func (ctx *Server) getReplies() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if _, err := ctx.findReview(r, vars["reviewId"]); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		replies, err := ctx.reviewStore(r).GetReplies(vars["reviewId"])
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		for i := range *replies {
+			reply := &(*replies)[i]
+			renderMessage(w, r, reply.Message, &reply.MessageHTML)
+		}
+		writeJson(200, replies)(w, r)
+	}
+}
+
+func (ctx *Server) getReply() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if _, err := ctx.findReview(r, vars["reviewId"]); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		reply, err := ctx.reviewStore(r).GetReply(vars["reviewId"], vars["replyId"])
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		renderMessage(w, r, reply.Message, &reply.MessageHTML)
+		writeJson(200, reply)(w, r)
+	}
+}
+
+func (ctx *Server) addReply() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		reviewId := vars["reviewId"]
+
+		var newReply reviews.NewReply
+		if err := json.NewDecoder(r.Body).Decode(&newReply); err != nil {
+			ErrorResponse(problems.FailedToParseJson(problems.ProblemJson{
+				Detail: err.Error(),
+			}))(w, r)
+			return
+		}
+
+		review, err := ctx.findReview(r, reviewId)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		user, err := ctx.authorizeReply(r, review)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		reply, err := ctx.reviewStore(r).AddReply(reviewId, reviews.Reply{
+			Message: newReply.Message,
+			UserID:  user.Uuid,
+		})
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		renderMessage(w, r, reply.Message, &reply.MessageHTML)
+		writeJson(201, reply)(w, r)
+	}
+}
+
+func (ctx *Server) updateReply() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		reviewId, replyId := vars["reviewId"], vars["replyId"]
+
+		var newReply reviews.NewReply
+		if err := json.NewDecoder(r.Body).Decode(&newReply); err != nil {
+			ErrorResponse(problems.FailedToParseJson(problems.ProblemJson{
+				Detail: err.Error(),
+			}))(w, r)
+			return
+		}
+
+		existing, err := ctx.reviewStore(r).GetReply(reviewId, replyId)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		if err := ctx.authorizeReplyChange(r, existing); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		reply, err := ctx.reviewStore(r).UpdateReply(reviewId, replyId, reviews.Reply{
+			Message: newReply.Message,
+		})
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		renderMessage(w, r, reply.Message, &reply.MessageHTML)
+		writeJson(200, reply)(w, r)
+	}
+}
+
+func (ctx *Server) deleteReply() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		reviewId, replyId := vars["reviewId"], vars["replyId"]
+
+		existing, err := ctx.reviewStore(r).GetReply(reviewId, replyId)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		if err := ctx.authorizeReplyChange(r, existing); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		if err := ctx.reviewStore(r).DeleteReply(reviewId, replyId); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		w.WriteHeader(204)
+		w.Write(nil)
+	}
+}
+
+func (ctx *Server) addUser() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		decoder := json.NewDecoder(r.Body)
 		var user users.NewUser
 		err := decoder.Decode(&user)
 		if err != nil {
@@ -258,7 +1634,7 @@ func (ctx *Server) addUser() MiddlewareFn {
 			}))(w, r)
 			return
 		}
-		res, createErr := ctx.Users.AddUser(user)
+		res, createErr := ctx.userStore(r).AddUser(user)
 		if createErr != nil {
 			ErrorResponse(createErr.(*problems.ProblemJson))(w, r)
 			return
@@ -267,6 +1643,216 @@ func (ctx *Server) addUser() MiddlewareFn {
 	}
 }
 
+// Every user, by username, a page at a time. Admins only
+func (ctx *Server) getUsers() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ctx.authenticateAdmin(r); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		limit, err := pageLimit(r, cursor.MAX_LIMIT)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		userList, err := ctx.userStore(r).GetUsers()
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		page, err := users.Paginate(*userList, limit, r.URL.Query().Get("cursor"))
+		if err != nil {
+			ErrorResponse(invalidCursor())(w, r)
+			return
+		}
+		writePageLinks(w, r, page.Next, page.Prev)
+		writeJson(200, page.Users)(w, r)
+	}
+}
+
+func (ctx *Server) getUser() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		user, err := ctx.userStore(r).GetUser(vars["userId"])
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeJson(200, user)(w, r)
+	}
+}
+
+// The caller's own profile
+func (ctx *Server) getMe() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := ctx.authenticate(r)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeJson(200, user)(w, r)
+	}
+}
+
+// Make sure the caller may change or delete an account, which only its own user may
+func (ctx *Server) authorizeUserChange(r *http.Request, account *users.User) error {
+	user, err := ctx.authenticate(r)
+	if err != nil {
+		return err
+	}
+	if user.Uuid == account.Uuid {
+		return nil
+	}
+	return problems.NotOwner(problems.ProblemJson{
+		Instance: users.BASE_PATH + "/" + account.Uuid,
+		Detail:   fmt.Sprintf("User, %s, may only change their own account", user.Username),
+	})
+}
+
+func (ctx *Server) patchUser() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId := vars["userId"]
+
+		existing, err := ctx.userStore(r).GetUser(userId)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		if err := ctx.authorizeUserChange(r, existing); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		var patch users.UserPatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			ErrorResponse(problems.FailedToParseJson(problems.ProblemJson{
+				Detail: err.Error(),
+			}))(w, r)
+			return
+		}
+		if patch.FullName != nil {
+			existing.FullName = *patch.FullName
+		}
+
+		user, err := ctx.userStore(r).UpdateUser(userId, *existing)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeJson(200, user)(w, r)
+	}
+}
+
+// Delete an account, along with its password and tokens. Its reviews and
+// stalls are left as they are.
+func (ctx *Server) deleteUser() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId := vars["userId"]
+
+		existing, err := ctx.userStore(r).GetUser(userId)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		if err := ctx.authorizeUserChange(r, existing); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		// Admin and moderator rights go by username, so freeing one up would
+		// hand them to whoever registers it next
+		if ctx.isModerator(existing) {
+			ErrorResponse(problems.InUse(problems.ProblemJson{
+				Instance: users.BASE_PATH + "/" + userId,
+				Detail:   "The username is listed in ADMIN_USERS or MODERATOR_USERS, take it out before deleting the account",
+			}))(w, r)
+			return
+		}
+
+		if err := ctx.userStore(r).DeleteUser(userId); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
+
+// The caller's sessions, one for each token they created
+func (ctx *Server) getTokens() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := ctx.authenticate(r)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		sessions, err := ctx.userStore(r).GetTokens(user.Uuid)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeJson(200, sessions)(w, r)
+	}
+}
+
+// Sign one of the caller's sessions out, which may be the one they're using
+func (ctx *Server) deleteToken() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		user, err := ctx.authenticate(r)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		if err := ctx.userStore(r).DeleteToken(user.Uuid, vars["tokenId"]); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
+
+// Sign the caller out everywhere
+func (ctx *Server) deleteTokens() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := ctx.authenticate(r)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		if err := ctx.userStore(r).DeleteTokens(user.Uuid); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		w.WriteHeader(204)
+	}
+}
+
+// Swap a refresh token for a new access token, and a new refresh token
+func (ctx *Server) refreshToken() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var refresh users.RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&refresh); err != nil {
+			ErrorResponse(problems.FailedToParseJson(problems.ProblemJson{
+				Detail: err.Error(),
+			}))(w, r)
+			return
+		}
+
+		token, err := ctx.userStore(r).RefreshToken(refresh.RefreshToken)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		if err := ctx.signAccessToken(token); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeJson(200, token)(w, r)
+	}
+}
+
 func (ctx *Server) createToken() MiddlewareFn {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -280,16 +1866,18 @@ func (ctx *Server) createToken() MiddlewareFn {
 			return
 		}
 
-		token, tokenErr := ctx.Users.CreateToken(user, "")
+		user.UserAgent = r.Header.Get("User-Agent")
+		user.Refresh = ctx.AccessKeys != nil
+		token, tokenErr := ctx.userStore(r).CreateToken(user, "")
 		if tokenErr != nil {
 			ErrorResponse(tokenErr.(*problems.ProblemJson))(w, r)
 			return
 		}
-
-		tokenRes := users.TokenResponse{
-			Token: token,
+		if err := ctx.signAccessToken(token); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
 		}
-		writeJson(201, tokenRes)(w, r)
+		writeJson(201, token)(w, r)
 	}
 
 }
@@ -307,10 +1895,11 @@ func (ctx *Server) addReview() MiddlewareFn {
 			return
 		}
 
-		token := r.Header.Get("Authorization")
-
-		if token != "" {
-			user, userErr := ctx.Users.UserFromToken(token)
+		// The author is whoever the token belongs to, never what the body says,
+		// since ownership checks and pre-moderation go by it
+		review.UserID = ""
+		if r.Header.Get("Authorization") != "" {
+			user, userErr := ctx.authenticate(r)
 			if userErr != nil {
 				ErrorResponse(userErr.(*problems.ProblemJson))(w, r)
 				return
@@ -318,44 +1907,263 @@ func (ctx *Server) addReview() MiddlewareFn {
 			review.UserID = user.Uuid
 		}
 
-		res, _ := ctx.Reviews.AddReview(review)
-		writeJson(201, res)(w, r)
+		// Reviews posted under /stalls/{stallId} are about that stall
+		if stallId, nested := mux.Vars(r)["stallId"]; nested {
+			if _, err := ctx.stallStore(r).GetStall(stallId); err != nil {
+				ErrorResponse(err.(*problems.ProblemJson))(w, r)
+				return
+			}
+			review.StallID = stallId
+		}
+		if err := ctx.checkStall(r, review.StallID); err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		// Under pre-moderation, anonymous reviews wait for a moderator
+		review.Status = reviews.PUBLISHED
+		if review.UserID == "" && ctx.PreModeration == PREMODERATE_ANONYMOUS {
+			review.Status = reviews.PENDING
+		}
+
+		res, addErr := ctx.reviewStore(r).AddReview(review)
+		if addErr != nil {
+			ErrorResponse(addErr.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeReview(201, res)(w, r)
 	}
 
 }
 
+// The filters and sort order of a list of reviews, from the query parameters
+func parseReviewQuery(r *http.Request) (reviews.ReviewFilters, func(a, b reviews.Review) bool, error) {
+	query := r.URL.Query()
+	filters, err := reviews.ParseFilters(query)
+	if err != nil {
+		return filters, nil, err
+	}
+	less, err := reviews.ParseSort(query.Get("sort"))
+	return filters, less, err
+}
+
 func (ctx *Server) getReviews() MiddlewareFn {
 	return func(w http.ResponseWriter, r *http.Request) {
-		query := r.URL.Query()
-		maxRating := query.Get("maxRating")
-		log.Printf("\nmaxRating: %s\n", maxRating)
-		var reviewList *[]reviews.Review
-		if maxRating != "" {
-			i, _ := strconv.Atoi(maxRating)
+		filters, less, err := parseReviewQuery(r)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
 
-			filters := reviews.ReviewFilters{
-				MaxRating: i,
+		// Listed under /stalls/{stallId}, so only that stall's reviews
+		if stallId, nested := mux.Vars(r)["stallId"]; nested {
+			if _, err := ctx.stallStore(r).GetStall(stallId); err != nil {
+				ErrorResponse(err.(*problems.ProblemJson))(w, r)
+				return
 			}
-			reviewList = ctx.Reviews.GetReviewsFiltered(filters)
-		} else {
-			reviewList = ctx.Reviews.GetReviews()
+			filters.StallID = stallId
+		}
+		// Listed under /users/{userId}, so only that user's reviews
+		if userId, nested := mux.Vars(r)["userId"]; nested {
+			if _, err := ctx.userStore(r).GetUser(userId); err != nil {
+				ErrorResponse(err.(*problems.ProblemJson))(w, r)
+				return
+			}
+			filters.UserID = userId
+		}
+
+		ctx.writeReviews(filters, less)(w, r)
+	}
+}
+
+// The caller's own reviews
+func (ctx *Server) getMyReviews() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := ctx.authenticate(r)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		filters, less, err := parseReviewQuery(r)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		filters.UserID = user.Uuid
+		ctx.writeReviews(filters, less)(w, r)
+	}
+}
+
+func (ctx *Server) writeReviews(filters reviews.ReviewFilters, less func(a, b reviews.Review) bool) MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reviewList, err := ctx.reviewStore(r).GetReviewsFiltered(filters)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeReviewPage(*reviewList, less)(w, r)
+	}
+}
+
+func (ctx *Server) getReviewStats() MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filters, err := reviews.ParseFilters(r.URL.Query())
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		stats, err := ctx.reviewStore(r).GetStats(filters)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+		writeJson(200, stats)(w, r)
+	}
+}
+
+// The limit query parameter of a paged list, or zero when there isn't one
+func pageLimit(r *http.Request, max int) (int, error) {
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 || limit > max {
+		return 0, problems.InvalidRequest(problems.ProblemJson{
+			Detail: fmt.Sprintf("Query parameter, limit, must be an integer from 1 to %d", max),
+		})
+	}
+	return limit, nil
+}
+
+func invalidCursor() *problems.ProblemJson {
+	return problems.InvalidRequest(problems.ProblemJson{
+		Detail: "Query parameter, cursor, is not a cursor this API handed out",
+	})
+}
+
+// Link to the neighbouring pages of a list in the Link header
+func writePageLinks(w http.ResponseWriter, r *http.Request, next, prev string) {
+	links := []string{}
+	if next != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageUrl(r, next)))
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	if prev != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageUrl(r, prev)))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// Write the page of reviews asked for by the limit and cursor query parameters.
+// Neighbouring pages are linked to in the Link header.
+func writeReviewPage(list []reviews.Review, less func(a, b reviews.Review) bool) MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, err := pageLimit(r, cursor.MAX_LIMIT)
+		if err != nil {
+			ErrorResponse(err.(*problems.ProblemJson))(w, r)
+			return
+		}
+
+		page, err := reviews.Paginate(list, less, limit, r.URL.Query().Get("cursor"))
+		if err != nil {
+			ErrorResponse(invalidCursor())(w, r)
+			return
+		}
+
+		writePageLinks(w, r, page.Next, page.Prev)
+		for i := range page.Reviews {
+			review := &page.Reviews[i]
+			renderMessage(w, r, review.Message, &review.MessageHTML)
 		}
-		writeJson(200, reviewList)(w, r)
+		writeJson(200, page.Reviews)(w, r)
+	}
+}
+
+// The absolute URL of the request, at another cursor
+func pageUrl(r *http.Request, cursor string) string {
+	query := r.URL.Query()
+	query.Set("cursor", cursor)
+
+	base := BASE_URL
+	if sb := sandboxFrom(r); sb != nil {
+		base += sandbox.BASE_PATH + "/" + sb.Id
 	}
+	return base + r.URL.Path + "?" + query.Encode()
 }
 
 func (ctx *Server) getReview() MiddlewareFn {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		reviewId := vars["reviewId"]
-		review, err := ctx.Reviews.GetReview(reviewId)
+		review, err := ctx.findReview(r, reviewId)
 		if err != nil {
 			ErrorResponse(err.(*problems.ProblemJson))(w, r)
-		} else {
-			writeJson(200, review)(w, r)
+			return
+		}
+		if header := r.Header.Get("If-None-Match"); header != "" && reviews.IfNoneMatch(header, *review) {
+			w.Header().Set("ETag", reviews.ETag(*review))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writeReview(200, review)(w, r)
+	}
+
+}
+
+// The version a change must be made against, from the If-Match header.
+// Without one, the change goes ahead whatever the version.
+func ifMatchVersion(r *http.Request, existing *reviews.Review) (int, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return reviews.ANY_VERSION, nil
+	}
+	if !reviews.IfMatch(header, *existing) {
+		return 0, problems.PreconditionFailed(problems.ProblemJson{
+			Instance: reviews.BASE_PATH + "/" + existing.Uuid,
+			Detail:   fmt.Sprintf("If-Match %s doesn't match the current ETag %s", header, reviews.ETag(*existing)),
+		})
+	}
+	return existing.Version, nil
+}
+
+// writeJson, with the review's ETag
+func writeReview(status int, review *reviews.Review) MiddlewareFn {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", reviews.ETag(*review))
+		renderMessage(w, r, review.Message, &review.MessageHTML)
+		writeJson(status, review)(w, r)
+	}
+}
+
+// Whether the client asked for messageHtml, with ?render=html or by
+// listing MESSAGE_HTML_PROFILE as a profile of application/json in Accept
+func wantsMessageHtml(r *http.Request) bool {
+	if r.URL.Query().Get("render") == "html" {
+		return true
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil || (mediaType != "application/json" && mediaType != "*/*") {
+			continue
+		}
+		for _, profile := range strings.Fields(params["profile"]) {
+			if profile == MESSAGE_HTML_PROFILE {
+				return true
+			}
 		}
 	}
+	return false
+}
 
+// Fills in messageHtml from message, when the client asked for it
+func renderMessage(w http.ResponseWriter, r *http.Request, message string, messageHtml *string) {
+	w.Header().Set("Vary", "Accept")
+	if wantsMessageHtml(r) {
+		*messageHtml = reviews.RenderMessage(message)
+	}
 }
 
 // Bunch of HTTP stuffs...
@@ -371,8 +2179,6 @@ func ErrorResponse(prob *problems.ProblemJson) MiddlewareFn {
 
 func writeJson(status int, msg interface{}) MiddlewareFn {
 	return func(w http.ResponseWriter, r *http.Request) {
-
-		log.Printf("%s", msg)
 		w.Header().Add("Content-type", "application/json")
 		msgBytes, _ := json.Marshal(msg)
 		w.WriteHeader(status)
@@ -0,0 +1,112 @@
+package stalls
+
+import (
+	"database/sql"
+	"farmstall/database"
+	"farmstall/problems"
+	"farmstall/utils"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SQLStalls keeps stalls in the stalls table, in a database opened with
+// farmstall/database
+type SQLStalls struct {
+	db *sql.DB
+}
+
+func NewSQLStalls(db *sql.DB) *SQLStalls {
+	return &SQLStalls{db: db}
+}
+
+var _ StallStore = (*SQLStalls)(nil)
+
+const COLUMNS = `uuid, name, description, location, owner_id, created_at, updated_at`
+
+func (ss *SQLStalls) AddStall(s Stall) (*Stall, error) {
+	s.Uuid = uuid.New().String()
+	s.CreatedAt = utils.Now()
+	s.UpdatedAt = s.CreatedAt
+	_, err := ss.db.Exec(`INSERT INTO stalls (`+COLUMNS+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		s.Uuid, s.Name, s.Description, s.Location, s.OwnerID, s.CreatedAt.UnixNano(), s.UpdatedAt.UnixNano())
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	return &s, nil
+}
+
+func (ss *SQLStalls) GetStall(id string) (*Stall, error) {
+	s, err := scanStall(ss.db.QueryRow(`SELECT `+COLUMNS+` FROM stalls WHERE uuid = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, notFound(id)
+	}
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	return s, nil
+}
+
+func (ss *SQLStalls) UpdateStall(id string, s Stall) (*Stall, error) {
+	res, err := ss.db.Exec(`UPDATE stalls SET name = ?, description = ?, location = ?, owner_id = ?, updated_at = ? WHERE uuid = ?`,
+		s.Name, s.Description, s.Location, s.OwnerID, utils.Now().UnixNano(), id)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, problems.UpdateNonExisting(problems.ProblemJson{
+			Instance: BASE_PATH + "/" + id,
+		})
+	}
+	return ss.GetStall(id)
+}
+
+func (ss *SQLStalls) DeleteStall(id string) error {
+	res, err := ss.db.Exec(`DELETE FROM stalls WHERE uuid = ?`, id)
+	if err != nil {
+		return database.Error(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound(id)
+	}
+	return nil
+}
+
+func (ss *SQLStalls) GetStalls() (*[]Stall, error) {
+	rows, err := ss.db.Query(`SELECT ` + COLUMNS + ` FROM stalls ORDER BY name, uuid`)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer rows.Close()
+
+	v := []Stall{}
+	for rows.Next() {
+		s, err := scanStall(rows)
+		if err != nil {
+			return nil, database.Error(err)
+		}
+		v = append(v, *s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.Error(err)
+	}
+	return &v, nil
+}
+
+func (ss *SQLStalls) Clear() error {
+	if _, err := ss.db.Exec(`DELETE FROM stalls`); err != nil {
+		return database.Error(err)
+	}
+	return nil
+}
+
+func scanStall(row database.Scanner) (*Stall, error) {
+	var s Stall
+	var createdAt, updatedAt int64
+	if err := row.Scan(&s.Uuid, &s.Name, &s.Description, &s.Location, &s.OwnerID, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	s.CreatedAt = time.Unix(0, createdAt).UTC()
+	s.UpdatedAt = time.Unix(0, updatedAt).UTC()
+	return &s, nil
+}
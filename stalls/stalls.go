@@ -0,0 +1,128 @@
+package stalls
+
+import (
+	"farmstall/problems"
+	"farmstall/utils"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const BASE_PATH = "/stalls"
+
+// Stall is a farm stall that reviews can be about
+type Stall struct {
+	Uuid        string `json:"uuid"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Free text, eg: an address or directions
+	Location string `json:"location"`
+	// The user who runs the stall, set to whoever created it
+	OwnerID   string    `json:"ownerId"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// NewStall is what clients send to create or replace a stall
+type NewStall struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Location    string `json:"location"`
+}
+
+// Stalls keeps stalls in memory, keyed by uuid. Requests share it, so every
+// method takes the lock.
+type Stalls struct {
+	mu     sync.RWMutex
+	Stalls map[string]Stall `json:"stalls"`
+}
+
+func NewStalls() *Stalls {
+	return &Stalls{Stalls: map[string]Stall{}}
+}
+
+func notFound(id string) error {
+	return problems.NotFound(problems.ProblemJson{
+		Instance: BASE_PATH + "/" + id,
+	})
+}
+
+func (ss *Stalls) AddStall(s Stall) (*Stall, error) {
+	s.Uuid = uuid.New().String()
+	s.CreatedAt = utils.Now()
+	s.UpdatedAt = s.CreatedAt
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.Stalls[s.Uuid] = s
+	return &s, nil
+}
+
+func (ss *Stalls) GetStall(id string) (*Stall, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	s, ok := ss.Stalls[id]
+	if !ok {
+		return nil, notFound(id)
+	}
+	return &s, nil
+}
+
+func (ss *Stalls) UpdateStall(id string, s Stall) (*Stall, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	existing, ok := ss.Stalls[id]
+	if !ok {
+		return nil, problems.UpdateNonExisting(problems.ProblemJson{
+			Instance: BASE_PATH + "/" + id,
+		})
+	}
+	s.Uuid = id
+	s.CreatedAt = existing.CreatedAt
+	s.UpdatedAt = utils.Now()
+	ss.Stalls[id] = s
+	return &s, nil
+}
+
+func (ss *Stalls) DeleteStall(id string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, ok := ss.Stalls[id]; !ok {
+		return notFound(id)
+	}
+	delete(ss.Stalls, id)
+	return nil
+}
+
+func (ss *Stalls) GetStalls() (*[]Stall, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	v := make([]Stall, 0, len(ss.Stalls))
+	for _, s := range ss.Stalls {
+		v = append(v, s)
+	}
+	sort.Slice(v, func(i, j int) bool { return byName(v[i], v[j]) })
+	return &v, nil
+}
+
+func (ss *Stalls) Clear() error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.Stalls = map[string]Stall{}
+	return nil
+}
+
+// Stalls are listed by name, with uuid breaking ties
+func byName(a, b Stall) bool {
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return a.Uuid < b.Uuid
+}
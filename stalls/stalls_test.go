@@ -0,0 +1,98 @@
+package stalls
+
+import (
+	"path/filepath"
+	"testing"
+
+	"farmstall/database"
+	"github.com/google/uuid"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// backends lists every StallStore implementation the tests run against
+var backends = map[string]func(t *testing.T) StallStore{
+	"memory": func(t *testing.T) StallStore {
+		return NewStalls()
+	},
+	"sqlite": func(t *testing.T) StallStore {
+		db, err := database.Open(database.SCHEME + filepath.Join(t.TempDir(), "farmstall.db"))
+		assert.NilError(t, err, "should open the database")
+		t.Cleanup(func() { db.Close() })
+		return NewSQLStalls(db)
+	},
+}
+
+func forEachStore(t *testing.T, test func(t *testing.T, stalls StallStore)) {
+	for name, newStore := range backends {
+		newStore := newStore
+		t.Run(name, func(t *testing.T) {
+			test(t, newStore(t))
+		})
+	}
+}
+
+func TestAddThenGetStall(t *testing.T) {
+	forEachStore(t, func(t *testing.T, stalls StallStore) {
+		owner := uuid.New().String()
+		added, err := stalls.AddStall(Stall{
+			Name:        "Ponelat Produce",
+			Description: "Avocados and honey",
+			Location:    "R44, Stellenbosch",
+			OwnerID:     owner,
+		})
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, added.Uuid != "", "should get a uuid")
+
+		gotten, err := stalls.GetStall(added.Uuid)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.DeepEqual(added, gotten), "should match the stall that was added")
+		assert.Assert(t, is.Equal(gotten.OwnerID, owner), "should keep the owner")
+	})
+}
+
+func TestGetStallNotFound(t *testing.T) {
+	forEachStore(t, func(t *testing.T, stalls StallStore) {
+		_, err := stalls.GetStall(uuid.New().String())
+		assert.ErrorContains(t, err, "/not-found")
+	})
+}
+
+func TestUpdateStall(t *testing.T) {
+	forEachStore(t, func(t *testing.T, stalls StallStore) {
+		added, _ := stalls.AddStall(Stall{Name: "Old name"})
+		updated, err := stalls.UpdateStall(added.Uuid, Stall{Name: "New name", Location: "Somewhere"})
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(updated.Name, "New name"), "should change the name")
+		assert.Assert(t, updated.CreatedAt.Equal(added.CreatedAt), "should keep createdAt")
+
+		_, err = stalls.UpdateStall(uuid.New().String(), Stall{Name: "Nobody"})
+		assert.ErrorContains(t, err, "Refusing to update a non-existing resource")
+	})
+}
+
+func TestDeleteStall(t *testing.T) {
+	forEachStore(t, func(t *testing.T, stalls StallStore) {
+		added, _ := stalls.AddStall(Stall{Name: "Short lived"})
+		assert.NilError(t, stalls.DeleteStall(added.Uuid), "should delete")
+		_, err := stalls.GetStall(added.Uuid)
+		assert.ErrorContains(t, err, "/not-found", "should be gone")
+		assert.ErrorContains(t, stalls.DeleteStall(added.Uuid), "/not-found", "should not delete twice")
+	})
+}
+
+func TestGetStallsByName(t *testing.T) {
+	forEachStore(t, func(t *testing.T, stalls StallStore) {
+		stalls.AddStall(Stall{Name: "Zebra Farm"})
+		stalls.AddStall(Stall{Name: "Apple Orchard"})
+
+		list, err := stalls.GetStalls()
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Len(*list, 2), "should list every stall")
+		assert.Assert(t, is.Equal((*list)[0].Name, "Apple Orchard"), "should sort by name")
+
+		assert.NilError(t, stalls.Clear(), "should clear")
+		list, _ = stalls.GetStalls()
+		assert.Assert(t, is.Len(*list, 0), "should be empty")
+	})
+}
@@ -0,0 +1,18 @@
+package stalls
+
+// StallStore holds the farm stalls that reviews can be about. It knows
+// nothing of reviews, so the server checks a stall has none left before
+// calling DeleteStall.
+type StallStore interface {
+	AddStall(s Stall) (*Stall, error)
+	GetStall(id string) (*Stall, error)
+	// UpdateStall replaces a stall, keeping its uuid and createdAt
+	UpdateStall(id string, s Stall) (*Stall, error)
+	DeleteStall(id string) error
+	// GetStalls lists every stall by name
+	GetStalls() (*[]Stall, error)
+	// Clear removes every stall
+	Clear() error
+}
+
+var _ StallStore = (*Stalls)(nil)
@@ -1,3 +1,3 @@
 #!/bin/sh
 
-go test ./reviews/ ./users/ ./passwords/
+go test -race ./...
@@ -0,0 +1,47 @@
+package users
+
+import (
+	"encoding/json"
+	"farmstall/cursor"
+	"sort"
+)
+
+// Page is one slice of the users, by username
+type Page struct {
+	Users []User
+	cursor.Links
+}
+
+// Usernames are unique, so one is all a cursor needs to find its place
+type byUsername []User
+
+func (us byUsername) Len() int { return len(us) }
+
+func (us byUsername) Key(i int) interface{} { return us[i].Username }
+
+func (us byUsername) Locate(data []byte) (func(i int) bool, func(i int) bool, error) {
+	var username string
+	if err := json.Unmarshal(data, &username); err != nil || username == "" {
+		return nil, nil, cursor.ErrInvalid
+	}
+	before := func(i int) bool { return us[i].Username < username }
+	after := func(i int) bool { return us[i].Username > username }
+	return before, after, nil
+}
+
+// Paginate sorts list by username and returns the page of at most limit
+// users found at cursor. An empty cursor is the first page and a limit of
+// zero means no limit.
+func Paginate(list []User, limit int, after string) (*Page, error) {
+	sorted := make(byUsername, len(list))
+	copy(sorted, list)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Username < sorted[j].Username
+	})
+
+	page, err := cursor.Paginate(sorted, limit, after)
+	if err != nil {
+		return nil, err
+	}
+	return &Page{Users: sorted[page.Start:page.End], Links: page.Links}, nil
+}
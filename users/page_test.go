@@ -0,0 +1,60 @@
+package users
+
+import (
+	"farmstall/cursor"
+	"fmt"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func fiveUsers() []User {
+	list := []User{}
+	// Shuffled, so paging has to sort by username first
+	for _, i := range []int{3, 0, 4, 1, 2} {
+		list = append(list, User{
+			Uuid:     fmt.Sprintf("uuid-%d", i),
+			Username: fmt.Sprintf("user-%d", i),
+		})
+	}
+	return list
+}
+
+func usernames(page *Page) []string {
+	v := []string{}
+	for _, u := range page.Users {
+		v = append(v, u.Username)
+	}
+	return v
+}
+
+func TestPaginateUsersWithoutLimit(t *testing.T) {
+	page, err := Paginate(fiveUsers(), 0, "")
+	assert.NilError(t, err, "should have no errors")
+	assert.Assert(t, is.DeepEqual(usernames(page), []string{"user-0", "user-1", "user-2", "user-3", "user-4"}))
+	assert.Assert(t, is.Equal(page.Next, ""), "should have no next page")
+	assert.Assert(t, is.Equal(page.Prev, ""), "should have no prev page")
+}
+
+func TestPaginateUsersForwardsAndBack(t *testing.T) {
+	list := fiveUsers()
+
+	first, _ := Paginate(list, 2, "")
+	assert.Assert(t, is.DeepEqual(usernames(first), []string{"user-0", "user-1"}))
+
+	second, _ := Paginate(list, 2, first.Next)
+	assert.Assert(t, is.DeepEqual(usernames(second), []string{"user-2", "user-3"}))
+
+	third, _ := Paginate(list, 2, second.Next)
+	assert.Assert(t, is.DeepEqual(usernames(third), []string{"user-4"}))
+	assert.Assert(t, is.Equal(third.Next, ""), "should have no next page")
+
+	back, _ := Paginate(list, 2, third.Prev)
+	assert.Assert(t, is.DeepEqual(usernames(back), usernames(second)), "should go back to the second page")
+}
+
+func TestPaginateUsersInvalidCursor(t *testing.T) {
+	_, err := Paginate(fiveUsers(), 2, "not a cursor")
+	assert.Equal(t, err, cursor.ErrInvalid)
+}
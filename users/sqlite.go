@@ -0,0 +1,348 @@
+package users
+
+import (
+	"database/sql"
+	"farmstall/database"
+	"farmstall/passwords"
+	"farmstall/problems"
+	"farmstall/utils"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// SQLUsers is a UserStore backed by a database opened with farmstall/database
+type SQLUsers struct {
+	db        *sql.DB
+	Passwords passwords.Store
+}
+
+func NewSQLUsers(db *sql.DB) *SQLUsers {
+	return &SQLUsers{
+		db:        db,
+		Passwords: passwords.NewSQLPasswordStore(db),
+	}
+}
+
+var _ UserStore = (*SQLUsers)(nil)
+
+func (us *SQLUsers) CreateToken(ul UserLogin, tokenOverride string) (*TokenResponse, error) {
+	user, userErr := us.GetUserByUsername(ul.Username)
+	if userErr != nil {
+		return nil, userErr
+	}
+
+	_, verifyErr := us.Passwords.Verify(user.Uuid, ul.Password)
+
+	if verifyErr != nil {
+		return nil, problems.InvalidCreds(problems.ProblemJson{
+			Detail: "Username or password is invalid",
+		})
+	}
+
+	res, session, err := newSession(user, ul, tokenOverride)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+
+	// Clear out the user's expired sessions while we're at it
+	_, err = us.db.Exec(`DELETE FROM tokens WHERE user_id = ? AND expires_at <= ?`,
+		user.Uuid, session.CreatedAt.UnixNano())
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	_, err = us.db.Exec(`INSERT OR REPLACE INTO tokens (`+TOKEN_COLUMNS+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.Uuid, session.Hash, session.UserID, session.Label, session.UserAgent,
+		session.CreatedAt.UnixNano(), session.LastUsedAt.UnixNano(), nullableTime(session.ExpiresAt), session.Refresh)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+
+	return res, nil
+}
+
+func (us *SQLUsers) GetUserByUsername(username string) (*User, error) {
+	row := us.db.QueryRow(`SELECT uuid, username, full_name FROM users WHERE username = ?`, username)
+	user, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		return nil, problems.NotFound(problems.ProblemJson{
+			Detail: fmt.Sprintf("No user with username, %s, found", username),
+		})
+	}
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	return user, nil
+}
+
+func (us *SQLUsers) AddUser(nu NewUser) (*User, error) {
+	existingUser, _ := us.GetUserByUsername(nu.Username)
+
+	if existingUser != nil {
+		return nil, problems.CreateAlreadyExists(problems.ProblemJson{
+			Instance: BASE_PATH + "/" + nu.Username,
+			Detail:   fmt.Sprintf("User with username, %s, already exists.", nu.Username),
+		})
+	}
+
+	u := User{
+		FullName: nu.FullName,
+		Username: nu.Username,
+		Uuid:     uuid.New().String(),
+	}
+
+	_, err := us.db.Exec(`INSERT INTO users (uuid, username, full_name) VALUES (?, ?, ?)`,
+		u.Uuid, u.Username, u.FullName)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if err := us.Passwords.Add(u.Uuid, nu.Password); err != nil {
+		return nil, database.Error(err)
+	}
+
+	return &u, nil
+}
+
+func (us *SQLUsers) GetUser(id string) (*User, error) {
+	row := us.db.QueryRow(`SELECT uuid, username, full_name FROM users WHERE uuid = ?`, id)
+	user, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		return nil, userNotFound(id)
+	}
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	return user, nil
+}
+
+func (us *SQLUsers) UpdateUser(id string, u User) (*User, error) {
+	res, err := us.db.Exec(`UPDATE users SET full_name = ? WHERE uuid = ?`, u.FullName, id)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, userNotFound(id)
+	}
+	return us.GetUser(id)
+}
+
+func (us *SQLUsers) DeleteUser(id string) error {
+	tx, err := us.db.Begin()
+	if err != nil {
+		return database.Error(err)
+	}
+	res, err := tx.Exec(`DELETE FROM users WHERE uuid = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return database.Error(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return userNotFound(id)
+	}
+	for _, table := range []string{"tokens", "passwords"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, id); err != nil {
+			tx.Rollback()
+			return database.Error(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return database.Error(err)
+	}
+	return nil
+}
+
+func (us *SQLUsers) GetUsers() (*[]User, error) {
+	rows, err := us.db.Query(`SELECT uuid, username, full_name FROM users`)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer rows.Close()
+
+	v := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, database.Error(err)
+		}
+		v = append(v, *user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.Error(err)
+	}
+	return &v, nil
+}
+
+func (us *SQLUsers) UserFromToken(token string) (*User, error) {
+	hash := hashToken(token)
+	session, err := scanSession(us.db.QueryRow(`SELECT `+TOKEN_COLUMNS+` FROM tokens WHERE hash = ?`, hash))
+	if err == sql.ErrNoRows {
+		return nil, invalidToken()
+	}
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if session.Refresh {
+		return nil, refreshOnly()
+	}
+	if err := session.check(); err != nil {
+		return nil, err
+	}
+	if err := us.touch(session.Uuid); err != nil {
+		return nil, err
+	}
+	return us.GetUser(session.UserID)
+}
+
+func (us *SQLUsers) UserFromSession(userId string, id string) (*User, error) {
+	session, err := scanSession(us.db.QueryRow(`SELECT `+TOKEN_COLUMNS+` FROM tokens WHERE uuid = ? AND user_id = ?`, id, userId))
+	if err == sql.ErrNoRows {
+		return nil, invalidToken()
+	}
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if err := session.check(); err != nil {
+		return nil, err
+	}
+	if err := us.touch(id); err != nil {
+		return nil, err
+	}
+	return us.GetUser(userId)
+}
+
+// Note that a session was used, to within lastUsedResolution
+func (us *SQLUsers) touch(id string) error {
+	now := utils.Now()
+	_, err := us.db.Exec(`UPDATE tokens SET last_used_at = ? WHERE uuid = ? AND last_used_at <= ?`,
+		now.UnixNano(), id, now.Add(-lastUsedResolution).UnixNano())
+	if err != nil {
+		return database.Error(err)
+	}
+	return nil
+}
+
+func (us *SQLUsers) RefreshToken(token string) (*TokenResponse, error) {
+	tx, err := us.db.Begin()
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer tx.Rollback()
+
+	hash := hashToken(token)
+	session, err := scanSession(tx.QueryRow(`SELECT `+TOKEN_COLUMNS+` FROM tokens WHERE hash = ?`, hash))
+	if err == sql.ErrNoRows {
+		return nil, invalidToken()
+	}
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if !session.Refresh {
+		return nil, notRefreshToken()
+	}
+	if err := session.check(); err != nil {
+		return nil, err
+	}
+	res, err := session.rotate()
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	_, err = tx.Exec(`UPDATE tokens SET hash = ?, last_used_at = ?, expires_at = ? WHERE uuid = ?`,
+		session.Hash, session.LastUsedAt.UnixNano(), nullableTime(session.ExpiresAt), session.Uuid)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, database.Error(err)
+	}
+	return res, nil
+}
+
+func (us *SQLUsers) GetTokens(userId string) (*[]Session, error) {
+	rows, err := us.db.Query(`SELECT `+TOKEN_COLUMNS+` FROM tokens WHERE user_id = ? ORDER BY created_at, uuid`, userId)
+	if err != nil {
+		return nil, database.Error(err)
+	}
+	defer rows.Close()
+
+	v := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, database.Error(err)
+		}
+		v = append(v, *session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.Error(err)
+	}
+	return &v, nil
+}
+
+func (us *SQLUsers) DeleteToken(userId string, id string) error {
+	res, err := us.db.Exec(`DELETE FROM tokens WHERE uuid = ? AND user_id = ?`, id, userId)
+	if err != nil {
+		return database.Error(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return tokenNotFound(id)
+	}
+	return nil
+}
+
+func (us *SQLUsers) DeleteTokens(userId string) error {
+	if _, err := us.db.Exec(`DELETE FROM tokens WHERE user_id = ?`, userId); err != nil {
+		return database.Error(err)
+	}
+	return nil
+}
+
+func (us *SQLUsers) Clear() error {
+	tx, err := us.db.Begin()
+	if err != nil {
+		return database.Error(err)
+	}
+	for _, table := range []string{"tokens", "passwords", "users"} {
+		if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+			tx.Rollback()
+			return database.Error(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return database.Error(err)
+	}
+	return nil
+}
+
+func nullableTime(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
+
+const TOKEN_COLUMNS = `uuid, hash, user_id, label, user_agent, created_at, last_used_at, expires_at, refresh`
+
+func scanSession(row database.Scanner) (*Session, error) {
+	var s Session
+	var createdAt, lastUsedAt int64
+	var expiresAt sql.NullInt64
+	if err := row.Scan(&s.Uuid, &s.Hash, &s.UserID, &s.Label, &s.UserAgent, &createdAt, &lastUsedAt, &expiresAt, &s.Refresh); err != nil {
+		return nil, err
+	}
+	s.CreatedAt = time.Unix(0, createdAt).UTC()
+	s.LastUsedAt = time.Unix(0, lastUsedAt).UTC()
+	if expiresAt.Valid {
+		t := time.Unix(0, expiresAt.Int64).UTC()
+		s.ExpiresAt = &t
+	}
+	return &s, nil
+}
+
+func scanUser(row database.Scanner) (*User, error) {
+	var u User
+	if err := row.Scan(&u.Uuid, &u.Username, &u.FullName); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
@@ -0,0 +1,36 @@
+package users
+
+// UserStore is implemented by every backend that can hold users and their
+// tokens. The HTTP handlers only ever talk to this interface, so backends
+// can be swapped without touching them.
+type UserStore interface {
+	AddUser(nu NewUser) (*User, error)
+	GetUser(id string) (*User, error)
+	GetUserByUsername(username string) (*User, error)
+	GetUsers() (*[]User, error)
+	// UpdateUser changes a user's full name, the only thing about them that can change
+	UpdateUser(id string, u User) (*User, error)
+	// DeleteUser removes a user, along with their password and tokens
+	DeleteUser(id string) error
+	// CreateToken checks a user's credentials and gives them a new token.
+	// Only a hash of it is kept.
+	CreateToken(ul UserLogin, tokenOverride string) (*TokenResponse, error)
+	// UserFromToken is problems.TokenExpired once a token is past its TTL
+	UserFromToken(token string) (*User, error)
+	// UserFromSession is who one of a user's sessions belongs to, so a signed
+	// access token stops working as soon as its session is ended
+	UserFromSession(userId string, id string) (*User, error)
+	// RefreshToken swaps a refresh token for a new one, in the same session
+	RefreshToken(token string) (*TokenResponse, error)
+	// GetTokens lists a user's sessions, oldest first
+	GetTokens(userId string) (*[]Session, error)
+	// DeleteToken ends one of a user's sessions
+	DeleteToken(userId string, id string) error
+	// DeleteTokens ends every session of a user
+	DeleteTokens(userId string) error
+	// Clear removes every user, along with their passwords and tokens
+	Clear() error
+}
+
+// Make sure the in-memory store keeps up with the interface
+var _ UserStore = (*Users)(nil)
@@ -0,0 +1,244 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"farmstall/problems"
+	"farmstall/utils"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TokenTTL is how long the tokens from CreateToken last. Zero means they
+// never expire.
+var TokenTTL = 24 * time.Hour
+
+// LastUsedAt is only moved on after this long, so using a token doesn't
+// mean a write every time
+const lastUsedResolution = time.Minute
+
+// Bytes of entropy in a new token
+const tokenSize = 32
+
+const TOKENS_PATH = "/tokens"
+
+// TokenResponse is what a client gets back for its credentials
+type TokenResponse struct {
+	// The session the token belongs to, for DELETE /tokens/{id}
+	Uuid  string `json:"uuid"`
+	Token string `json:"token"`
+	// nil when the token never expires
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// When the server hands out signed access tokens, Token is one of those
+	// and the store's own token becomes the refresh token
+	RefreshToken     string     `json:"refreshToken,omitempty"`
+	RefreshExpiresAt *time.Time `json:"refreshExpiresAt,omitempty"`
+	// Who the token is for
+	UserID string `json:"-"`
+}
+
+// RefreshRequest is what clients send to POST /tokens/refresh
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// Session is one signed in client. A user has one for every token they
+// created. The token itself is only ever handed to the client, a session
+// just keeps its hash.
+type Session struct {
+	Uuid       string     `json:"uuid"`
+	UserID     string     `json:"-"`
+	Hash       string     `json:"-"`
+	Label      string     `json:"label"`
+	UserAgent  string     `json:"userAgent"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt time.Time  `json:"lastUsedAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	// Refresh tokens are only good for RefreshToken, not for UserFromToken
+	Refresh bool `json:"refresh"`
+}
+
+func newToken() (string, error) {
+	b := make([]byte, tokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Tokens are random enough that a fast hash is all they need. Sessions are
+// looked up by it, in a map or a database index, which isn't constant time.
+// That's fine: timing can at most tell how close a guess's hash is to a
+// stored one, and that says nothing about the token behind it.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s Session) expired(at time.Time) bool {
+	return s.ExpiresAt != nil && !at.Before(*s.ExpiresAt)
+}
+
+// Start a session for user. A tokenOverride, eg: from a seed file, is used
+// as is and never expires, so well known tokens keep working.
+func newSession(user *User, ul UserLogin, tokenOverride string) (*TokenResponse, *Session, error) {
+	token := tokenOverride
+	if token == "" {
+		var err error
+		if token, err = newToken(); err != nil {
+			return nil, nil, err
+		}
+	}
+	s := Session{
+		Uuid:      uuid.New().String(),
+		UserID:    user.Uuid,
+		Hash:      hashToken(token),
+		Label:     ul.Label,
+		UserAgent: ul.UserAgent,
+		CreatedAt: utils.Now(),
+		Refresh:   ul.Refresh,
+	}
+	s.LastUsedAt = s.CreatedAt
+	if tokenOverride == "" && TokenTTL > 0 {
+		expiresAt := s.CreatedAt.Add(TokenTTL)
+		s.ExpiresAt = &expiresAt
+	}
+	return s.response(token), &s, nil
+}
+
+func (s Session) response(token string) *TokenResponse {
+	return &TokenResponse{Uuid: s.Uuid, Token: token, ExpiresAt: s.ExpiresAt, UserID: s.UserID}
+}
+
+// Swap a refresh token for a new one, so each can only be used once. The
+// session keeps its uuid and gets a fresh TTL.
+func (s *Session) rotate() (*TokenResponse, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	s.Hash = hashToken(token)
+	s.LastUsedAt = utils.Now()
+	if TokenTTL > 0 {
+		expiresAt := s.LastUsedAt.Add(TokenTTL)
+		s.ExpiresAt = &expiresAt
+	}
+	return s.response(token), nil
+}
+
+func notRefreshToken() error {
+	return problems.InvalidCreds(problems.ProblemJson{
+		Detail: "Not a refresh token",
+	})
+}
+
+func refreshOnly() error {
+	return problems.InvalidCreds(problems.ProblemJson{
+		Detail: "A refresh token can only be used with POST /tokens/refresh",
+	})
+}
+
+func invalidToken() error {
+	return problems.InvalidCreds(problems.ProblemJson{
+		Detail: "Invalid token",
+	})
+}
+
+func tokenNotFound(id string) error {
+	return problems.NotFound(problems.ProblemJson{
+		Instance: TOKENS_PATH + "/" + id,
+		Detail:   fmt.Sprintf("You have no token with uuid, %s", id),
+	})
+}
+
+// Expired tokens stop working, and are cleared out the next time their user signs in
+func (s Session) check() error {
+	if s.expired(time.Now()) {
+		return problems.TokenExpired(problems.ProblemJson{
+			Detail: fmt.Sprintf("The token expired at %s", s.ExpiresAt.Format(time.RFC3339)),
+		})
+	}
+	return nil
+}
+
+// Sessions are listed oldest first
+func byCreatedAt(a, b Session) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.Uuid < b.Uuid
+}
+
+func (us *Users) RefreshToken(token string) (*TokenResponse, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	hash := hashToken(token)
+	session, ok := us.Tokens[hash]
+	if !ok {
+		return nil, invalidToken()
+	}
+	if !session.Refresh {
+		return nil, notRefreshToken()
+	}
+	if err := session.check(); err != nil {
+		return nil, err
+	}
+	res, err := session.rotate()
+	if err != nil {
+		return nil, problems.Internal(problems.ProblemJson{
+			Detail: err.Error(),
+		})
+	}
+	us.deleteSession(hash)
+	us.putSession(session)
+	return res, nil
+}
+
+func (us *Users) GetTokens(userId string) (*[]Session, error) {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	v := []Session{}
+	for _, s := range us.Tokens {
+		if s.UserID == userId {
+			v = append(v, s)
+		}
+	}
+	sort.Slice(v, func(i, j int) bool { return byCreatedAt(v[i], v[j]) })
+	return &v, nil
+}
+
+func (us *Users) DeleteToken(userId string, id string) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	hash, ok := us.Sessions[id]
+	if !ok || us.Tokens[hash].UserID != userId {
+		return tokenNotFound(id)
+	}
+	us.deleteSession(hash)
+	return nil
+}
+
+func (us *Users) DeleteTokens(userId string) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	us.deleteTokens(userId, nil)
+	return nil
+}
+
+// Remove a user's sessions, or only those that expired by a time. Callers must hold us.mu
+func (us *Users) deleteTokens(userId string, expiredBy *time.Time) {
+	for hash, s := range us.Tokens {
+		if s.UserID == userId && (expiredBy == nil || s.expired(*expiredBy)) {
+			us.deleteSession(hash)
+		}
+	}
+}
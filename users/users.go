@@ -3,11 +3,11 @@ package users
 import (
 	"farmstall/passwords"
 	"farmstall/problems"
+	"farmstall/utils"
 	"fmt"
 	"github.com/google/uuid"
 	_ "log"
-	"math/rand"
-	"time"
+	"sync"
 )
 
 type UserMap map[string]User
@@ -20,10 +20,15 @@ type User struct {
 	FullName string `json:"fullName"`
 }
 
+// Users is the in-memory UserStore. It is safe for concurrent use.
 type Users struct {
+	mu        sync.RWMutex
 	Users     map[string]User `json:"users"`
-	Passwords *passwords.PasswordStore
-	Tokens    map[string]string
+	Passwords passwords.Store
+	// Every user's sessions, by the hash of their token
+	Tokens map[string]Session
+	// The hash of each session's token, by the session's uuid
+	Sessions map[string]string
 }
 
 type NewUser struct {
@@ -33,41 +38,62 @@ type NewUser struct {
 	Password string `json:"password"`
 }
 
+// UserPatch is what clients send to change their account. Fields left out
+// stay as they are.
+type UserPatch struct {
+	FullName *string `json:"fullName"`
+}
+
 type UserLogin struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// Tells the user's sessions apart, eg: "Phone"
+	Label string `json:"label"`
+	// Of the client signing in, filled in by the server
+	UserAgent string `json:"-"`
+	// Set by the server when the token will only be used to refresh signed
+	// access tokens
+	Refresh bool `json:"-"`
 }
 
-type TokenResponse struct {
-	Token string `json:"token"`
-}
-
-func (us *Users) CreateToken(ul UserLogin, tokenOverride string) (string, error) {
+func (us *Users) CreateToken(ul UserLogin, tokenOverride string) (*TokenResponse, error) {
 	user, userErr := us.GetUserByUsername(ul.Username)
 	if userErr != nil {
-		return "", userErr
+		return nil, userErr
 	}
 
 	_, verifyErr := us.Passwords.Verify(user.Uuid, ul.Password)
 
 	if verifyErr != nil {
-		return "", problems.InvalidCreds(problems.ProblemJson{
+		return nil, problems.InvalidCreds(problems.ProblemJson{
 			Detail: "Username or password is invalid",
 		})
 	}
 
-	var token string
-	if tokenOverride != "" {
-		token = tokenOverride
-	} else {
-		token = RandomString(10)
+	res, session, err := newSession(user, ul, tokenOverride)
+	if err != nil {
+		return nil, problems.Internal(problems.ProblemJson{
+			Detail: err.Error(),
+		})
 	}
-	us.Tokens[user.Uuid] = token
 
-	return token, nil
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	us.deleteTokens(user.Uuid, &session.CreatedAt)
+	us.putSession(*session)
+
+	return res, nil
 }
 
 func (us *Users) GetUserByUsername(username string) (*User, error) {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	return us.getUserByUsername(username)
+}
+
+// Callers must hold us.mu
+func (us *Users) getUserByUsername(username string) (*User, error) {
 	var user *User
 	for _, testUser := range us.Users {
 		if testUser.Username == username {
@@ -86,7 +112,10 @@ func (us *Users) GetUserByUsername(username string) (*User, error) {
 }
 
 func (us *Users) AddUser(nu NewUser) (*User, error) {
-	existingUser, _ := us.GetUserByUsername(nu.Username)
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	existingUser, _ := us.getUserByUsername(nu.Username)
 
 	if existingUser != nil {
 		return nil, problems.CreateAlreadyExists(problems.ProblemJson{
@@ -109,30 +138,54 @@ func (us *Users) AddUser(nu NewUser) (*User, error) {
 }
 
 func (us *Users) GetUser(id string) (*User, error) {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
 	var user User
 	var ok bool
 	user, ok = us.Users[id]
 	if !ok {
-		return nil, problems.NotFound(problems.ProblemJson{
-			Instance: BASE_PATH + "/" + id,
-			Detail:   fmt.Sprintf("User with uuid, %s, does not exist.", id),
-		})
+		return nil, userNotFound(id)
 	}
 	return &user, nil
 }
 
+func userNotFound(id string) error {
+	return problems.NotFound(problems.ProblemJson{
+		Instance: BASE_PATH + "/" + id,
+		Detail:   fmt.Sprintf("User with uuid, %s, does not exist.", id),
+	})
+}
+
+func (us *Users) UpdateUser(id string, u User) (*User, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	existing, ok := us.Users[id]
+	if !ok {
+		return nil, userNotFound(id)
+	}
+	existing.FullName = u.FullName
+	us.Users[id] = existing
+	return &existing, nil
+}
+
 func (us *Users) DeleteUser(id string) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
 	if _, ok := us.Users[id]; !ok {
-		return problems.NotFound(problems.ProblemJson{
-			Instance: BASE_PATH + "/" + id,
-			Detail:   fmt.Sprintf("User with uuid, %s, does not exist.", id),
-		})
+		return userNotFound(id)
 	}
 	delete(us.Users, id)
-	return nil
+	us.deleteTokens(id, nil)
+	return us.Passwords.Delete(id)
 }
 
 func (us *Users) GetUsers() (*[]User, error) {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
 	v := make([]User, 0, len(us.Users))
 	for _, value := range us.Users {
 		v = append(v, value)
@@ -141,41 +194,85 @@ func (us *Users) GetUsers() (*[]User, error) {
 }
 
 func (us *Users) UserFromToken(token string) (*User, error) {
-	for id, tok := range us.Tokens {
-		if tok == token {
-			user := us.Users[id]
-			return &user, nil
-		}
+	us.mu.RLock()
+	session, ok := us.Tokens[hashToken(token)]
+	user := us.Users[session.UserID]
+	us.mu.RUnlock()
+
+	if !ok {
+		return nil, invalidToken()
 	}
+	if session.Refresh {
+		return nil, refreshOnly()
+	}
+	if err := session.check(); err != nil {
+		return nil, err
+	}
+	us.touch(session)
+	return &user, nil
+}
 
-	return nil, problems.InvalidCreds(problems.ProblemJson{
-		Detail: "Invalid token",
-	})
+func (us *Users) UserFromSession(userId string, id string) (*User, error) {
+	us.mu.RLock()
+	session, ok := us.Tokens[us.Sessions[id]]
+	user := us.Users[userId]
+	us.mu.RUnlock()
+
+	if !ok || session.UserID != userId {
+		return nil, invalidToken()
+	}
+	if err := session.check(); err != nil {
+		return nil, err
+	}
+	us.touch(session)
+	return &user, nil
 }
 
-func NewUsers() *Users {
-	us := Users{
-		Users:     UserMap{},
-		Passwords: passwords.NewPasswordStore(),
-		Tokens:    make(map[string]string),
+// Note that a session was used, to within lastUsedResolution. Most uses are
+// within it, so the write lock is only taken when there's something to note
+func (us *Users) touch(s Session) {
+	now := utils.Now()
+	if now.Sub(s.LastUsedAt) < lastUsedResolution {
+		return
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	// The session may have been rotated or ended since it was read
+	if current, ok := us.Tokens[s.Hash]; ok && current.Uuid == s.Uuid {
+		current.LastUsedAt = now
+		us.Tokens[s.Hash] = current
 	}
-	return &us
 }
 
-const charset = "abcdefghijklmnopqrstuvwxyz" +
-	"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+// Store a session under both of its keys. Callers must hold us.mu
+func (us *Users) putSession(s Session) {
+	us.Tokens[s.Hash] = s
+	us.Sessions[s.Uuid] = s.Hash
+}
 
-var seededRand *rand.Rand = rand.New(
-	rand.NewSource(time.Now().UnixNano()))
+// Callers must hold us.mu
+func (us *Users) deleteSession(hash string) {
+	delete(us.Sessions, us.Tokens[hash].Uuid)
+	delete(us.Tokens, hash)
+}
 
-func RandomStringWithCharset(length int, charset string) string {
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
-	}
-	return string(b)
+func (us *Users) Clear() error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	us.Users = UserMap{}
+	us.Tokens = make(map[string]Session)
+	us.Sessions = make(map[string]string)
+	return us.Passwords.Clear()
 }
 
-func RandomString(length int) string {
-	return RandomStringWithCharset(length, charset)
+func NewUsers() *Users {
+	us := Users{
+		Users:     UserMap{},
+		Passwords: passwords.NewPasswordStore(),
+		Tokens:    make(map[string]Session),
+		Sessions:  make(map[string]string),
+	}
+	return &us
 }
@@ -1,108 +1,532 @@
 package users
 
 import (
+	"farmstall/database"
+	"fmt"
 	"gotest.tools/assert"
 	is "gotest.tools/assert/cmp"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 )
 
+// backends lists every UserStore implementation the tests run against
+var backends = map[string]func(t *testing.T) UserStore{
+	"memory": func(t *testing.T) UserStore {
+		return NewUsers()
+	},
+	"sqlite": func(t *testing.T) UserStore {
+		db, err := database.Open(database.SCHEME + filepath.Join(t.TempDir(), "farmstall.db"))
+		assert.NilError(t, err, "should open the database")
+		t.Cleanup(func() { db.Close() })
+		return NewSQLUsers(db)
+	},
+}
+
+func forEachStore(t *testing.T, test func(t *testing.T, users UserStore)) {
+	for name, newStore := range backends {
+		newStore := newStore
+		t.Run(name, func(t *testing.T) {
+			test(t, newStore(t))
+		})
+	}
+}
+
 func TestGetUsersEmpty(t *testing.T) {
-	users := NewUsers()
-	res, err := users.GetUsers()
-	assert.NilError(t, err, "should have no errors")
-	assert.Assert(t, is.Len(*res, 0), "should return empty list of users")
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		res, err := users.GetUsers()
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Len(*res, 0), "should return empty list of users")
+	})
 }
 
 func TestAddOneUser(t *testing.T) {
-	us := NewUsers()
-	us.AddUser(NewUser{
-		Username: "ponelat",
-		FullName: "Josh Ponelat",
-		Password: "password",
+	forEachStore(t, func(t *testing.T, us UserStore) {
+		us.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+		allUsers, _ := us.GetUsers()
+		assert.Assert(t, is.Len(*allUsers, 1), "should update the list of users")
 	})
-	assert.Assert(t, is.Len(us.Users, 1), "should update the list of users")
 }
 
 func TestAddOneUserResponse(t *testing.T) {
-	us := NewUsers()
-	user, _ := us.AddUser(NewUser{
-		Username: "ponelat",
-		FullName: "Josh Ponelat",
-		Password: "password",
+	forEachStore(t, func(t *testing.T, us UserStore) {
+		user, _ := us.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+		uuid := user.Uuid
+		assert.Assert(t, is.Equal(*user, User{
+			FullName: "Josh Ponelat",
+			Username: "ponelat",
+			Uuid:     uuid,
+		}), "should return a User object")
 	})
-	uuid := user.Uuid
-	assert.Assert(t, is.Equal(*user, User{
-		FullName: "Josh Ponelat",
-		Username: "ponelat",
-		Uuid:     uuid,
-	}), "should return a User object")
 }
 
 func TestAddThenGetOneUser(t *testing.T) {
-	us := NewUsers()
-	addedUser, _ := us.AddUser(NewUser{
-		Username: "ponelat",
-		FullName: "Josh Ponelat",
-		Password: "password",
-	})
+	forEachStore(t, func(t *testing.T, us UserStore) {
+		addedUser, _ := us.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
 
-	gottenUser, err := us.GetUser(addedUser.Uuid)
+		gottenUser, err := us.GetUser(addedUser.Uuid)
 
-	assert.NilError(t, err, "should have no errors")
-	assert.Assert(t, is.DeepEqual(addedUser, gottenUser), "should match the user in memory")
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.DeepEqual(addedUser, gottenUser), "should match the user in memory")
+	})
 }
 
 func TestAddTwoThenGetAllUsers(t *testing.T) {
-	users := NewUsers()
-	users.AddUser(NewUser{
-		Username: "ponelat",
-		FullName: "Josh Ponelat",
-		Password: "password",
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+		users.AddUser(NewUser{
+			Username: "bgerh",
+			FullName: "Bob Gerhard",
+			Password: "password",
+		})
+
+		allUsers, err := users.GetUsers()
+
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Len(*allUsers, 2), "should match the number of users added")
 	})
-	users.AddUser(NewUser{
-		Username: "bgerh",
-		FullName: "Bob Gerhard",
-		Password: "password",
+}
+
+func TestCreateTokenFromUsernameAndPassword(t *testing.T) {
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+
+		token, err := users.CreateToken(UserLogin{
+			Username: "ponelat",
+			Password: "password",
+		}, "")
+
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Len(token.Token, 43), "should be 32 random bytes, base64 encoded")
+		assert.Assert(t, token.ExpiresAt != nil, "should expire")
+		assert.Assert(t, token.ExpiresAt.After(time.Now()), "should expire in the future")
+
+		other, _ := users.CreateToken(UserLogin{
+			Username: "ponelat",
+			Password: "password",
+		}, "")
+		assert.Assert(t, other.Token != token.Token, "should be random")
+
+		user, err := users.UserFromToken(other.Token)
+		assert.NilError(t, err, "should find the user from the token")
+		assert.Assert(t, is.Equal(user.Username, "ponelat"))
 	})
+}
 
-	allUsers, err := users.GetUsers()
+func TestExpiredToken(t *testing.T) {
+	defer func(ttl time.Duration) { TokenTTL = ttl }(TokenTTL)
+	TokenTTL = time.Millisecond
 
-	assert.NilError(t, err, "should have no errors")
-	assert.Assert(t, is.Len(*allUsers, 2), "should match the number of users added")
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		user, _ := users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+		token, _ := users.CreateToken(UserLogin{
+			Username: "ponelat",
+			Password: "password",
+		}, "")
+		time.Sleep(2 * time.Millisecond)
+
+		_, err := users.UserFromToken(token.Token)
+		assert.ErrorContains(t, err, "/token-expired")
+		_, err = users.UserFromSession(user.Uuid, token.Uuid)
+		assert.ErrorContains(t, err, "/token-expired", "should not find a user by an expired session either")
+		_, err = users.UserFromToken("not a token")
+		assert.ErrorContains(t, err, "Invalid token", "should tell unknown tokens apart from expired ones")
+	})
 }
 
-func TestCreateTokenFromUsernameAndPassword(t *testing.T) {
+func TestTokenOverrideNeverExpires(t *testing.T) {
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+		token, err := users.CreateToken(UserLogin{
+			Username: "ponelat",
+			Password: "password",
+		}, "aabbcceeff")
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(token.Token, "aabbcceeff"))
+		assert.Assert(t, token.ExpiresAt == nil, "should never expire")
+	})
+}
+
+func TestTokensAreStoredHashed(t *testing.T) {
 	users := NewUsers()
 	users.AddUser(NewUser{
 		Username: "ponelat",
 		FullName: "Josh Ponelat",
 		Password: "password",
 	})
-
-	token, err := users.CreateToken(UserLogin{
+	token, _ := users.CreateToken(UserLogin{
 		Username: "ponelat",
 		Password: "password",
 	}, "")
 
-	assert.NilError(t, err, "should have no errors")
-	assert.Assert(t, is.Len(token, 10), "should be a string ten characters long")
+	assert.Assert(t, is.Len(users.Tokens, 1))
+	for hash, session := range users.Tokens {
+		assert.Assert(t, hash != token.Token, "should not keep the token itself")
+		assert.Assert(t, is.Equal(session.Hash, hashToken(token.Token)))
+		assert.Assert(t, is.Equal(session.Uuid, token.Uuid))
+	}
+}
+
+func TestManySessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		ponelat, _ := users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+		mckenzie, _ := users.AddUser(NewUser{
+			Username: "mckenzie",
+			FullName: "Bob McKenzie",
+			Password: "password",
+		})
+		laptop, _ := users.CreateToken(UserLogin{
+			Username:  "ponelat",
+			Password:  "password",
+			Label:     "Laptop",
+			UserAgent: "curl/7.68.0",
+		}, "")
+		phone, _ := users.CreateToken(UserLogin{
+			Username: "ponelat",
+			Password: "password",
+			Label:    "Phone",
+		}, "")
+		other, _ := users.CreateToken(UserLogin{
+			Username: "mckenzie",
+			Password: "password",
+		}, "")
+
+		for _, token := range []*TokenResponse{laptop, phone} {
+			_, err := users.UserFromToken(token.Token)
+			assert.NilError(t, err, "signing in again should keep the other session")
+		}
+
+		sessions, err := users.GetTokens(ponelat.Uuid)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Len(*sessions, 2), "should only list the user's own sessions")
+		assert.Assert(t, is.Equal((*sessions)[0].Uuid, laptop.Uuid), "should be oldest first")
+		assert.Assert(t, is.Equal((*sessions)[0].Label, "Laptop"))
+		assert.Assert(t, is.Equal((*sessions)[0].UserAgent, "curl/7.68.0"))
+		assert.Assert(t, is.DeepEqual((*sessions)[0].ExpiresAt, laptop.ExpiresAt))
+
+		err = users.DeleteToken(mckenzie.Uuid, laptop.Uuid)
+		assert.ErrorContains(t, err, "/not-found", "should not end someone else's session")
+
+		assert.NilError(t, users.DeleteToken(ponelat.Uuid, laptop.Uuid))
+		_, err = users.UserFromToken(laptop.Token)
+		assert.ErrorContains(t, err, "Invalid token")
+		_, err = users.UserFromToken(phone.Token)
+		assert.NilError(t, err, "should keep the other session")
+
+		assert.NilError(t, users.DeleteTokens(ponelat.Uuid))
+		_, err = users.UserFromToken(phone.Token)
+		assert.ErrorContains(t, err, "Invalid token", "should end every session")
+		_, err = users.UserFromToken(other.Token)
+		assert.NilError(t, err, "should keep other users' sessions")
+	})
+}
+
+func TestRefreshToken(t *testing.T) {
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		user, _ := users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+		refresh, _ := users.CreateToken(UserLogin{
+			Username: "ponelat",
+			Password: "password",
+			Refresh:  true,
+		}, "")
+		assert.Assert(t, is.Equal(refresh.UserID, user.Uuid))
+
+		_, err := users.UserFromToken(refresh.Token)
+		assert.ErrorContains(t, err, "can only be used with POST /tokens/refresh")
+
+		next, err := users.RefreshToken(refresh.Token)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(next.Uuid, refresh.Uuid), "should stay in the same session")
+		assert.Assert(t, is.Equal(next.UserID, user.Uuid))
+		assert.Assert(t, next.Token != refresh.Token, "should rotate the refresh token")
+
+		_, err = users.RefreshToken(refresh.Token)
+		assert.ErrorContains(t, err, "Invalid token", "should only use a refresh token once")
+		_, err = users.RefreshToken(next.Token)
+		assert.NilError(t, err, "should accept the new refresh token")
+
+		access, _ := users.CreateToken(UserLogin{
+			Username: "ponelat",
+			Password: "password",
+		}, "")
+		_, err = users.RefreshToken(access.Token)
+		assert.ErrorContains(t, err, "Not a refresh token")
+
+		sessions, _ := users.GetTokens(user.Uuid)
+		assert.Assert(t, is.Len(*sessions, 2))
+	})
+}
+
+func TestUserFromSession(t *testing.T) {
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		user, _ := users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+		other, _ := users.AddUser(NewUser{
+			Username: "mckenzie",
+			FullName: "Bob McKenzie",
+			Password: "password",
+		})
+		session, _ := users.CreateToken(UserLogin{
+			Username: "ponelat",
+			Password: "password",
+			Refresh:  true,
+		}, "")
+
+		found, err := users.UserFromSession(user.Uuid, session.Uuid)
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(found.Username, "ponelat"))
+		_, err = users.UserFromSession(other.Uuid, session.Uuid)
+		assert.ErrorContains(t, err, "Invalid token", "should only find a user's own sessions")
+
+		assert.NilError(t, users.DeleteTokens(user.Uuid))
+		_, err = users.UserFromSession(user.Uuid, session.Uuid)
+		assert.ErrorContains(t, err, "Invalid token", "should stop once the session is ended")
+	})
+}
+
+func TestSigningInClearsExpiredSessions(t *testing.T) {
+	defer func(ttl time.Duration) { TokenTTL = ttl }(TokenTTL)
+
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		user, _ := users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+		login := UserLogin{Username: "ponelat", Password: "password"}
+
+		TokenTTL = time.Millisecond
+		users.CreateToken(login, "")
+		time.Sleep(2 * time.Millisecond)
+		TokenTTL = time.Hour
+		users.CreateToken(login, "")
+
+		sessions, _ := users.GetTokens(user.Uuid)
+		assert.Assert(t, is.Len(*sessions, 1), "should only keep the live session")
+	})
 }
 
 func TestCreateUserWithSameUsernameGivesError(t *testing.T) {
-	users := NewUsers()
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
 
-	users.AddUser(NewUser{
-		Username: "ponelat",
-		FullName: "Josh Ponelat",
-		Password: "password",
+		_, err := users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+
+		assert.ErrorContains(t, err, "/create-already-exists")
+		allUsers, _ := users.GetUsers()
+		assert.Assert(t, is.Len(*allUsers, 1), "should only contain one user")
 	})
+}
 
-	_, err := users.AddUser(NewUser{
-		Username: "ponelat",
-		FullName: "Josh Ponelat",
-		Password: "password",
+func TestClearUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+		users.CreateToken(UserLogin{
+			Username: "ponelat",
+			Password: "password",
+		}, "aabbcceeff")
+
+		err := users.Clear()
+		assert.NilError(t, err, "should have no errors")
+
+		allUsers, _ := users.GetUsers()
+		assert.Assert(t, is.Len(*allUsers, 0), "should have no users")
+		_, err = users.UserFromToken("aabbcceeff")
+		assert.ErrorContains(t, err, "Invalid token", "should revoke every token")
+
+		// The username is free again
+		_, err = users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "other",
+		})
+		assert.NilError(t, err, "should have no errors")
+	})
+}
+
+func TestUpdateUser(t *testing.T) {
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		user, _ := users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+
+		updated, err := users.UpdateUser(user.Uuid, User{
+			Username: "someone-else",
+			FullName: "Joshua Ponelat",
+		})
+		assert.NilError(t, err, "should have no errors")
+		assert.Assert(t, is.Equal(updated.FullName, "Joshua Ponelat"))
+		assert.Assert(t, is.Equal(updated.Username, "ponelat"), "should keep the username")
+
+		got, _ := users.GetUser(user.Uuid)
+		assert.Assert(t, is.DeepEqual(got, updated))
+
+		_, err = users.UpdateUser("missing", User{FullName: "Nobody"})
+		assert.ErrorContains(t, err, "/not-found")
+	})
+}
+
+func TestDeleteUserRevokesTokenAndPassword(t *testing.T) {
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		user, _ := users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "password",
+		})
+		users.CreateToken(UserLogin{
+			Username: "ponelat",
+			Password: "password",
+		}, "aabbcceeff")
+
+		assert.NilError(t, users.DeleteUser(user.Uuid))
+
+		_, err := users.GetUser(user.Uuid)
+		assert.ErrorContains(t, err, "/not-found")
+		_, err = users.UserFromToken("aabbcceeff")
+		assert.ErrorContains(t, err, "Invalid token", "should revoke their token")
+
+		// A new account with the same username doesn't get the old password
+		users.AddUser(NewUser{
+			Username: "ponelat",
+			FullName: "Josh Ponelat",
+			Password: "other",
+		})
+		_, err = users.CreateToken(UserLogin{
+			Username: "ponelat",
+			Password: "password",
+		}, "")
+		assert.ErrorContains(t, err, "Username or password is invalid")
+
+		err = users.DeleteUser(user.Uuid)
+		assert.ErrorContains(t, err, "/not-found", "should only delete once")
 	})
+}
+
+// Run with -race to catch unsynchronised access
+func TestConcurrentAddUserSameUsername(t *testing.T) {
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		const workers = 20
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		created := 0
 
-	assert.ErrorContains(t, err, "/create-already-exists")
-	assert.Assert(t, is.Len(users.Users, 1), "should only contain one user")
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := users.AddUser(NewUser{
+					Username: "ponelat",
+					FullName: "Josh Ponelat",
+					Password: "password",
+				})
+				if err == nil {
+					mu.Lock()
+					created++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Assert(t, is.Equal(created, 1), "should only let one caller claim the username")
+	})
+}
+
+// Run with -race to catch unsynchronised access
+func TestConcurrentTokensAndLookups(t *testing.T) {
+	forEachStore(t, func(t *testing.T, users UserStore) {
+		const workers = 20
+		var wg sync.WaitGroup
+
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				username := fmt.Sprintf("user%d", i)
+				added, err := users.AddUser(NewUser{
+					Username: username,
+					FullName: "Some User",
+					Password: "password",
+				})
+				assert.Check(t, err, "should add")
+				if err != nil {
+					return
+				}
+
+				token, err := users.CreateToken(UserLogin{
+					Username: username,
+					Password: "password",
+				}, "")
+				assert.Check(t, err, "should create a token")
+				if err != nil {
+					return
+				}
+
+				user, err := users.UserFromToken(token.Token)
+				assert.Check(t, err, "should find the user from the token")
+				if err == nil {
+					assert.Check(t, is.Equal(user.Uuid, added.Uuid), "should be the same user")
+				}
+				users.GetUsers()
+			}(i)
+		}
+		wg.Wait()
+
+		allUsers, _ := users.GetUsers()
+		assert.Assert(t, is.Len(*allUsers, workers), "should have added every user")
+	})
 }
@@ -3,8 +3,16 @@ package utils
 import (
 	"encoding/json"
 	_ "log"
+	"time"
 )
 
+// Now is the time every store stamps things with. It is in UTC, without a
+// monotonic clock reading, so it compares equal after a round trip through
+// the database.
+func Now() time.Time {
+	return time.Now().UTC()
+}
+
 type NullString string
 
 func (s NullString) MarshalJSON() ([]byte, error) {
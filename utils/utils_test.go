@@ -2,6 +2,7 @@ package utils
 
 import (
 	"testing"
+	"time"
 
 	"encoding/json"
 	"gotest.tools/assert"
@@ -39,3 +40,9 @@ func TestUnmarshalNullStringFromNull(t *testing.T) {
 	json.Unmarshal([]byte(jsonStr), &ns)
 	assert.Assert(t, is.Equal(string(ns), ""), "should deserialize from null")
 }
+
+func TestNowSurvivesARoundTrip(t *testing.T) {
+	stamp := Now()
+	assert.Assert(t, is.Equal(stamp.Location(), time.UTC), "should be in UTC")
+	assert.Assert(t, stamp == time.Unix(0, stamp.UnixNano()).UTC(), "should equal itself read back from unix nanoseconds")
+}